@@ -4,27 +4,41 @@ import { getCurrentMonthRange } from '@/utils/time-logic'
 import { supabaseAdmin } from '@/lib/supabase-init/supabase-server'
 
 /**
- * Calculate the total duration, in seconds, of a user's audio files created during the current month.
+ * Calculate the seconds of transcription a user used during the current month: the durations of their audio files,
+ * uploads and saved live sessions, plus the live sessions the socket server metered without saving an audio file.
+ * The socket server sums the same rows for its live quota.
  *
- * @param userId - The ID of the user whose audio file durations will be aggregated
- * @returns The sum of the `duration` fields (in seconds) for the user's audio files created within the current month
+ * @param userId - The ID of the user whose usage will be aggregated
+ * @returns The sum of the `duration` fields (in seconds) for the user's audio files created within the current month and of the `audio_seconds` of their unsaved live sessions
+ * @throws The database error raised when a query fails
  */
 export async function getMonthlyUsageSeconds(userId: string) {
   const { start, end } = getCurrentMonthRange()
 
-  const { data, error } = await supabaseAdmin
-    .from('audio_files')
-    .select('duration')
-    .eq('user_id', userId)
-    .gte('created_at', start)
-    .lt('created_at', end)
+  const [files, ledger] = await Promise.all([
+    supabaseAdmin
+      .from('audio_files')
+      .select('duration')
+      .eq('user_id', userId)
+      .gte('created_at', start)
+      .lt('created_at', end),
+    supabaseAdmin
+      .from('usage_ledger')
+      .select('audio_seconds')
+      .eq('user_id', userId)
+      .eq('period_start', start)
+      .is('audio_id', null),
+  ])
 
-  if (error) throw error
+  if (files.error) throw files.error
+  if (ledger.error) throw ledger.error
 
-  const totalSeconds =
-    data?.reduce((sum, file) => sum + (file.duration || 0), 0) || 0
+  const fileSeconds =
+    files.data?.reduce((sum, file) => sum + (file.duration || 0), 0) || 0
+  const liveSeconds =
+    ledger.data?.reduce((sum, row) => sum + row.audio_seconds, 0) || 0
 
-  return totalSeconds
+  return fileSeconds + liveSeconds
 }
 
 /**
@@ -377,6 +377,44 @@ export type Database = {
           },
         ]
       }
+      usage_ledger: {
+        Row: {
+          audio_id: string | null
+          audio_seconds: number
+          created_at: string | null
+          id: string
+          period_start: string
+          session_id: string
+          user_id: string
+        }
+        Insert: {
+          audio_id?: string | null
+          audio_seconds: number
+          created_at?: string | null
+          id?: string
+          period_start: string
+          session_id: string
+          user_id: string
+        }
+        Update: {
+          audio_id?: string | null
+          audio_seconds?: number
+          created_at?: string | null
+          id?: string
+          period_start?: string
+          session_id?: string
+          user_id?: string
+        }
+        Relationships: [
+          {
+            foreignKeyName: 'usage_ledger_audio_id_fkey'
+            columns: ['audio_id']
+            isOneToOne: false
+            referencedRelation: 'audio_files'
+            referencedColumns: ['id']
+          },
+        ]
+      }
       users: {
         Row: {
           created_at: string | null
@@ -1,13 +1,14 @@
 /**
- * Get the ISO date range covering the current month.
+ * Get the ISO date range covering the current calendar month in UTC, the period usage quotas are counted in
+ * (the socket server counts live sessions over the same range).
  *
  * @returns An object with `start` set to the ISO timestamp for the first day of the current month and `end` set to the ISO timestamp for the first day of the next month
  */
 export function getCurrentMonthRange() {
     const now = new Date()
 
-    const start = new Date(now.getFullYear(), now.getMonth(), 1)
-    const end = new Date(now.getFullYear(), now.getMonth() + 1, 1)
+    const start = new Date(Date.UTC(now.getUTCFullYear(), now.getUTCMonth(), 1))
+    const end = new Date(Date.UTC(now.getUTCFullYear(), now.getUTCMonth() + 1, 1))
 
     return {
         start: start.toISOString(),
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"meetingmind-socket/internal/fakeassembly"
+	"net/http"
+	"os"
+)
+
+// Runs the fake AssemblyAI streaming api, start the socket server with
+// ASSEMBLYAI_BASE_URL=http://localhost:9191 to use it.
+func main() {
+	addr := flag.String("addr", "localhost:9191", "address to listen on")
+	fixture := flag.String("fixture", "hello", "name of the embedded fixture to replay")
+	scriptPath := flag.String("script", "", "path to a script json file, overrides -fixture")
+	dropAfter := flag.Int("drop-after", 0, "bytes of audio after which streams break off, 0 never drops")
+	drops := flag.Int("drops", 1, "how many streams break off with -drop-after")
+	flag.Parse()
+
+	var script fakeassembly.Script
+	var err error
+	if *scriptPath != "" {
+		data, readErr := os.ReadFile(*scriptPath)
+		if readErr != nil {
+			log.Fatal("failed to read script:", readErr)
+		}
+		script, err = fakeassembly.ParseScript(data)
+	} else {
+		script, err = fakeassembly.LoadFixture(*fixture)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fake := fakeassembly.NewServer(os.Getenv("ASSEMBLYAI_API_KEY"), script)
+	if *dropAfter > 0 {
+		fake.DropStreams(*drops, *dropAfter)
+	}
+	log.Println("Fake AssemblyAI listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, fake))
+}
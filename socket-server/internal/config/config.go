@@ -0,0 +1,667 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is everything the server reads at startup. Defaults come first,
+// then the optional CONFIG_FILE, then the environment, which wins.
+type Config struct {
+	Port        string
+	IsProd      bool
+	DatabaseUrl string
+	// SupabaseJwtKey verifies legacy HS256 tokens, asymmetric ones are verified with Auth.JwksURL or Auth.JwksFile
+	SupabaseJwtKey string
+	// FrontendUrl is the web app, it is also the allowed origin when AllowedOrigins is empty.
+	FrontendUrl    string
+	AllowedOrigins []string
+	// AllowAnyOrigin skips the origin check, for the local test client only.
+	AllowAnyOrigin bool
+
+	Auth      AuthConfig
+	Log       LogConfig
+	Upstream  UpstreamConfig
+	Session   SessionConfig
+	Room      RoomConfig
+	Drain     DrainConfig
+	Translate TranslateConfig
+	Recording RecordingConfig
+	Billing   BillingConfig
+	Features  FeatureConfig
+	RateLimit RateLimitConfig
+	Health    HealthConfig
+	Admin     AdminConfig
+	Metrics   MetricsConfig
+}
+
+type AuthConfig struct {
+	// JwksURL or JwksFile hold the public keys of RS256/ES256 tokens, reloaded every JwksCacheTTL
+	// and when a token names a key id that isn't known yet
+	JwksURL      string
+	JwksFile     string
+	JwksCacheTTL time.Duration
+	// Issuer and Audience must match the iss and aud claims, an empty one isn't checked
+	Issuer   string
+	Audience string
+	// Roles the role claim may hold, empty accepts any
+	Roles []string
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+type UpstreamConfig struct {
+	ApiKey  string
+	BaseURL string
+	// TokenTTL is how long a streaming token can be used to open the upstream websocket.
+	TokenTTL time.Duration
+	// ConnectTimeout bounds minting a token and dialing the stream
+	ConnectTimeout time.Duration
+	// a dropped stream is reopened up to ReconnectAttempts times, waiting ReconnectBackoff
+	// after the first failure and twice as long after each next one, up to ReconnectMaxBackoff
+	ReconnectAttempts   int
+	ReconnectBackoff    time.Duration
+	ReconnectMaxBackoff time.Duration
+	// ReconnectBuffer is how much audio is kept for the new stream, older audio is dropped
+	ReconnectBuffer time.Duration
+}
+
+type SessionConfig struct {
+	MaxLength time.Duration
+	// a session goroutine gives up after this many errors
+	MaxErrors         int
+	ResumeGraceWindow time.Duration
+	MaxReplayMessages int
+	// largest websocket frame accepted from the browser
+	MaxMessageBytes int64
+	SaveTimeout     time.Duration
+	// MaxConcurrent caps the live sessions of one user below their plan, 0 leaves it to the plan
+	MaxConcurrent int
+	// ConcurrentPolicy is "reject" to refuse a session over the cap or "takeover" to end the user's oldest one
+	ConcurrentPolicy string
+	// the browser is told this long before its access token expires to send a refreshed one
+	TokenExpiryWarning time.Duration
+	// QueueSize is how many transcript or translate messages can wait for the browser
+	// before it counts as slow and its connection is dropped
+	QueueSize int
+	// a write to the browser taking longer fails and drops the connection
+	WriteTimeout time.Duration
+}
+
+type RoomConfig struct {
+	QueueSize          int
+	ViewerWriteTimeout time.Duration
+	// an issued room nobody speaks in within ClaimTimeout is closed
+	ClaimTimeout time.Duration
+}
+
+type DrainConfig struct {
+	Timeout time.Duration
+	// upstream streams are terminated this long before the drain deadline
+	TerminateBefore time.Duration
+}
+
+type TranslateConfig struct {
+	ApiURL string
+	ApiKey string
+}
+
+type RecordingConfig struct {
+	// "" turns recording off, "local" writes under Dir
+	Storage string
+	Dir     string
+}
+
+type BillingConfig struct {
+	// Enforce looks up the subscription of every user, off gives everyone the Pro plan
+	Enforce bool
+	// PastDuePolicy is "downgrade" to the free plan or "refuse" live sessions
+	PastDuePolicy string
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Default applies to every route without its own entry in Routes
+	Default RateLimit
+	// Routes by ServeMux pattern, e.g. "/ws"
+	Routes map[string]RateLimit
+	// TrustedProxies may tell the client ip in X-Forwarded-For or X-Real-IP
+	TrustedProxies []netip.Prefix
+	// limiter entries unused this long are dropped
+	IdleTimeout time.Duration
+}
+
+// RateLimit allows PerSecond requests on average and bursts of Burst, per client ip and per user.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+type HealthConfig struct {
+	// CheckTimeout bounds every /readyz dependency check
+	CheckTimeout time.Duration
+	// minting an AssemblyAI token is checked at most this often
+	UpstreamCheckInterval time.Duration
+}
+
+type AdminConfig struct {
+	// UserIDs may use the admin API, empty turns it off
+	UserIDs []string
+}
+
+type MetricsConfig struct {
+	// Addr is the internal listener of /metrics, apart from the public port. Empty turns it off
+	Addr string
+}
+
+type FeatureConfig struct {
+	Translation bool
+	Rooms       bool
+	Resume      bool
+}
+
+func Default() *Config {
+	return &Config{
+		Auth: AuthConfig{
+			JwksCacheTTL: 10 * time.Minute,
+			Audience:     "authenticated",
+			Roles:        []string{"authenticated"},
+		},
+		Log: LogConfig{Level: "info", Format: "text"},
+		Upstream: UpstreamConfig{
+			BaseURL:             "https://streaming.assemblyai.com",
+			TokenTTL:            time.Minute,
+			ConnectTimeout:      10 * time.Second,
+			ReconnectAttempts:   5,
+			ReconnectBackoff:    500 * time.Millisecond,
+			ReconnectMaxBackoff: 8 * time.Second,
+			ReconnectBuffer:     30 * time.Second,
+		},
+		Session: SessionConfig{
+			MaxLength:          30 * time.Minute,
+			MaxErrors:          10,
+			ResumeGraceWindow:  30 * time.Second,
+			MaxReplayMessages:  500,
+			MaxMessageBytes:    1 << 20,
+			SaveTimeout:        30 * time.Second,
+			ConcurrentPolicy:   "reject",
+			TokenExpiryWarning: 2 * time.Minute,
+			QueueSize:          256,
+			WriteTimeout:       10 * time.Second,
+		},
+		Room: RoomConfig{
+			QueueSize:          64,
+			ViewerWriteTimeout: 5 * time.Second,
+			ClaimTimeout:       10 * time.Minute,
+		},
+		Drain: DrainConfig{
+			Timeout:         30 * time.Second,
+			TerminateBefore: 5 * time.Second,
+		},
+		Recording: RecordingConfig{Dir: "recordings"},
+		Billing: BillingConfig{
+			Enforce:       true,
+			PastDuePolicy: "downgrade",
+		},
+		Features: FeatureConfig{
+			Translation: true,
+			Rooms:       true,
+			Resume:      true,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Default: RateLimit{PerSecond: 10, Burst: 20},
+			Routes: map[string]RateLimit{
+				"/ws":      {PerSecond: 1, Burst: 5},
+				"/ws/room": {PerSecond: 1, Burst: 5},
+			},
+			IdleTimeout: 10 * time.Minute,
+		},
+		Health: HealthConfig{
+			CheckTimeout:          2 * time.Second,
+			UpstreamCheckInterval: time.Minute,
+		},
+		Metrics: MetricsConfig{Addr: ":9091"},
+	}
+}
+
+// Load reads .env if there is one, the optional CONFIG_FILE and the environment.
+// Every invalid or missing setting is reported in the one returned error.
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env: %w", err)
+	}
+
+	cfg := Default()
+	var errs []error
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, fileErrs := readFile(path)
+		errs = append(errs, fileErrs...)
+		errs = append(errs, cfg.apply(values, func(s setting) string { return s.key })...)
+	}
+
+	values := make(map[string]string)
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			values[s.env] = v
+		}
+	}
+	errs = append(errs, cfg.apply(values, func(s setting) string { return s.env })...)
+	errs = append(errs, cfg.validate()...)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// Addr is where the http server listens.
+func (c *Config) Addr() string {
+	if c.IsProd {
+		return ":" + c.Port
+	}
+	return "0.0.0.0:" + c.Port
+}
+
+// Origins are the browser origins allowed to open a websocket.
+func (c *Config) Origins() []string {
+	if len(c.AllowedOrigins) > 0 {
+		return c.AllowedOrigins
+	}
+	return []string{c.FrontendUrl}
+}
+
+// setting binds one field to its key in the config file and its env var.
+type setting struct {
+	key string
+	env string
+	set func(c *Config, raw string) error
+}
+
+var settings = []setting{
+	{"port", "PORT", stringVar(func(c *Config) *string { return &c.Port })},
+	{"is_prod", "IS_PROD", boolVar(func(c *Config) *bool { return &c.IsProd })},
+	{"database_url", "DATABASE_URL", stringVar(func(c *Config) *string { return &c.DatabaseUrl })},
+	{"supabase_jwt_key", "SUPABASE_JWT_KEY", stringVar(func(c *Config) *string { return &c.SupabaseJwtKey })},
+	{"frontend_url", "FRONTEND_URL", stringVar(func(c *Config) *string { return &c.FrontendUrl })},
+	{"allowed_origins", "ALLOWED_ORIGINS", listVar(func(c *Config) *[]string { return &c.AllowedOrigins })},
+	{"allow_any_origin", "IS_USING_CLIENT_TEST", boolVar(func(c *Config) *bool { return &c.AllowAnyOrigin })},
+
+	{"auth.jwks_url", "SUPABASE_JWKS_URL", stringVar(func(c *Config) *string { return &c.Auth.JwksURL })},
+	{"auth.jwks_file", "SUPABASE_JWKS_FILE", stringVar(func(c *Config) *string { return &c.Auth.JwksFile })},
+	{"auth.jwks_cache_ttl", "JWKS_CACHE_TTL", durationVar(func(c *Config) *time.Duration { return &c.Auth.JwksCacheTTL })},
+	{"auth.issuer", "JWT_ISSUER", stringVar(func(c *Config) *string { return &c.Auth.Issuer })},
+	{"auth.audience", "JWT_AUDIENCE", stringVar(func(c *Config) *string { return &c.Auth.Audience })},
+	{"auth.roles", "JWT_ROLES", listVar(func(c *Config) *[]string { return &c.Auth.Roles })},
+
+	{"log.level", "LOG_LEVEL", stringVar(func(c *Config) *string { return &c.Log.Level })},
+	{"log.format", "LOG_FORMAT", stringVar(func(c *Config) *string { return &c.Log.Format })},
+
+	{"upstream.api_key", "ASSEMBLYAI_API_KEY", stringVar(func(c *Config) *string { return &c.Upstream.ApiKey })},
+	{"upstream.base_url", "ASSEMBLYAI_BASE_URL", stringVar(func(c *Config) *string { return &c.Upstream.BaseURL })},
+	{"upstream.token_ttl", "ASSEMBLYAI_TOKEN_TTL", durationVar(func(c *Config) *time.Duration { return &c.Upstream.TokenTTL })},
+	{"upstream.connect_timeout", "ASSEMBLYAI_CONNECT_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Upstream.ConnectTimeout })},
+	{"upstream.reconnect_attempts", "ASSEMBLYAI_RECONNECT_ATTEMPTS", intVar(func(c *Config) *int { return &c.Upstream.ReconnectAttempts })},
+	{"upstream.reconnect_backoff", "ASSEMBLYAI_RECONNECT_BACKOFF", durationVar(func(c *Config) *time.Duration { return &c.Upstream.ReconnectBackoff })},
+	{"upstream.reconnect_max_backoff", "ASSEMBLYAI_RECONNECT_MAX_BACKOFF", durationVar(func(c *Config) *time.Duration { return &c.Upstream.ReconnectMaxBackoff })},
+	{"upstream.reconnect_buffer", "ASSEMBLYAI_RECONNECT_BUFFER", durationVar(func(c *Config) *time.Duration { return &c.Upstream.ReconnectBuffer })},
+
+	{"session.max_length", "SESSION_MAX_LENGTH", durationVar(func(c *Config) *time.Duration { return &c.Session.MaxLength })},
+	{"session.max_errors", "SESSION_MAX_ERRORS", intVar(func(c *Config) *int { return &c.Session.MaxErrors })},
+	{"session.resume_grace_window", "SESSION_RESUME_GRACE_WINDOW", durationVar(func(c *Config) *time.Duration { return &c.Session.ResumeGraceWindow })},
+	{"session.max_replay_messages", "SESSION_MAX_REPLAY_MESSAGES", intVar(func(c *Config) *int { return &c.Session.MaxReplayMessages })},
+	{"session.max_message_bytes", "SESSION_MAX_MESSAGE_BYTES", int64Var(func(c *Config) *int64 { return &c.Session.MaxMessageBytes })},
+	{"session.save_timeout", "SESSION_SAVE_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Session.SaveTimeout })},
+	{"session.max_concurrent", "SESSION_MAX_CONCURRENT", intVar(func(c *Config) *int { return &c.Session.MaxConcurrent })},
+	{"session.concurrent_policy", "SESSION_CONCURRENT_POLICY", stringVar(func(c *Config) *string { return &c.Session.ConcurrentPolicy })},
+	{"session.token_expiry_warning", "SESSION_TOKEN_EXPIRY_WARNING", durationVar(func(c *Config) *time.Duration { return &c.Session.TokenExpiryWarning })},
+	{"session.queue_size", "SESSION_QUEUE_SIZE", intVar(func(c *Config) *int { return &c.Session.QueueSize })},
+	{"session.write_timeout", "SESSION_WRITE_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Session.WriteTimeout })},
+
+	{"room.queue_size", "ROOM_QUEUE_SIZE", intVar(func(c *Config) *int { return &c.Room.QueueSize })},
+	{"room.viewer_write_timeout", "ROOM_VIEWER_WRITE_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Room.ViewerWriteTimeout })},
+	{"room.claim_timeout", "ROOM_CLAIM_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Room.ClaimTimeout })},
+
+	{"drain.timeout_seconds", "DRAIN_TIMEOUT_SECONDS", secondsVar(func(c *Config) *time.Duration { return &c.Drain.Timeout })},
+	{"drain.terminate_before", "DRAIN_TERMINATE_BEFORE", durationVar(func(c *Config) *time.Duration { return &c.Drain.TerminateBefore })},
+
+	{"translate.api_url", "TRANSLATE_API_URL", stringVar(func(c *Config) *string { return &c.Translate.ApiURL })},
+	{"translate.api_key", "TRANSLATE_API_KEY", stringVar(func(c *Config) *string { return &c.Translate.ApiKey })},
+
+	{"recording.storage", "RECORDING_STORAGE", stringVar(func(c *Config) *string { return &c.Recording.Storage })},
+	{"recording.dir", "RECORDING_DIR", stringVar(func(c *Config) *string { return &c.Recording.Dir })},
+
+	{"billing.enforce", "BILLING_ENFORCE", boolVar(func(c *Config) *bool { return &c.Billing.Enforce })},
+	{"billing.past_due_policy", "BILLING_PAST_DUE_POLICY", stringVar(func(c *Config) *string { return &c.Billing.PastDuePolicy })},
+
+	{"features.translation", "FEATURE_TRANSLATION", boolVar(func(c *Config) *bool { return &c.Features.Translation })},
+	{"features.rooms", "FEATURE_ROOMS", boolVar(func(c *Config) *bool { return &c.Features.Rooms })},
+	{"features.resume", "FEATURE_RESUME", boolVar(func(c *Config) *bool { return &c.Features.Resume })},
+
+	{"rate_limit.enabled", "RATE_LIMIT_ENABLED", boolVar(func(c *Config) *bool { return &c.RateLimit.Enabled })},
+	{"rate_limit.default", "RATE_LIMIT_DEFAULT", rateVar(func(c *Config) *RateLimit { return &c.RateLimit.Default })},
+	{"rate_limit.routes", "RATE_LIMIT_ROUTES", routeRatesVar(func(c *Config) *map[string]RateLimit { return &c.RateLimit.Routes })},
+	{"rate_limit.trusted_proxies", "TRUSTED_PROXIES", prefixListVar(func(c *Config) *[]netip.Prefix { return &c.RateLimit.TrustedProxies })},
+	{"rate_limit.idle_timeout", "RATE_LIMIT_IDLE_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.RateLimit.IdleTimeout })},
+
+	{"health.check_timeout", "HEALTH_CHECK_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Health.CheckTimeout })},
+	{"health.upstream_check_interval", "HEALTH_UPSTREAM_CHECK_INTERVAL", durationVar(func(c *Config) *time.Duration { return &c.Health.UpstreamCheckInterval })},
+
+	{"admin.user_ids", "ADMIN_USER_IDS", listVar(func(c *Config) *[]string { return &c.Admin.UserIDs })},
+	{"metrics.addr", "METRICS_ADDR", stringVar(func(c *Config) *string { return &c.Metrics.Addr })},
+}
+
+// apply sets every value it knows, name picks whether values are keyed by file key or env var.
+func (c *Config) apply(values map[string]string, name func(s setting) string) []error {
+	var errs []error
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		n := name(s)
+		known[n] = true
+		raw, ok := values[n]
+		if !ok {
+			continue
+		}
+		if err := s.set(c, strings.TrimSpace(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n, err))
+		}
+	}
+	for n := range values {
+		if !known[n] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", n))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validate() []error {
+	var errs []error
+	required := func(name string, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	positive := func(name string, value int64) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	httpURL := func(name string, value string) {
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("%s: %q is not an http(s) url", name, value))
+		}
+	}
+
+	required("PORT", c.Port)
+	if _, err := strconv.ParseUint(c.Port, 10, 16); c.Port != "" && err != nil {
+		errs = append(errs, fmt.Errorf("PORT: %q is not a port number", c.Port))
+	}
+	required("DATABASE_URL", c.DatabaseUrl)
+	if c.SupabaseJwtKey == "" && c.Auth.JwksURL == "" && c.Auth.JwksFile == "" {
+		errs = append(errs, errors.New("SUPABASE_JWT_KEY, SUPABASE_JWKS_URL or SUPABASE_JWKS_FILE is required"))
+	}
+	if c.Auth.JwksURL != "" && c.Auth.JwksFile != "" {
+		errs = append(errs, errors.New("SUPABASE_JWKS_URL and SUPABASE_JWKS_FILE can't both be set"))
+	}
+	if c.Auth.JwksURL != "" {
+		httpURL("SUPABASE_JWKS_URL", c.Auth.JwksURL)
+	}
+	positive("JWKS_CACHE_TTL", int64(c.Auth.JwksCacheTTL))
+	required("FRONTEND_URL", c.FrontendUrl)
+	required("ASSEMBLYAI_API_KEY", c.Upstream.ApiKey)
+	if c.FrontendUrl != "" {
+		httpURL("FRONTEND_URL", c.FrontendUrl)
+	}
+	for _, origin := range c.AllowedOrigins {
+		httpURL("ALLOWED_ORIGINS", origin)
+	}
+	httpURL("ASSEMBLYAI_BASE_URL", c.Upstream.BaseURL)
+	if c.Translate.ApiURL != "" {
+		httpURL("TRANSLATE_API_URL", c.Translate.ApiURL)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %q is not debug, info, warn or error", c.Log.Level))
+	}
+	if !slices.Contains([]string{"text", "json"}, c.Log.Format) {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT: %q is not text or json", c.Log.Format))
+	}
+
+	// AssemblyAI accepts tokens living from 1 to 600 seconds
+	if c.Upstream.TokenTTL < time.Second || c.Upstream.TokenTTL > 10*time.Minute {
+		errs = append(errs, fmt.Errorf("ASSEMBLYAI_TOKEN_TTL must be between 1s and 10m, got %s", c.Upstream.TokenTTL))
+	}
+	positive("ASSEMBLYAI_CONNECT_TIMEOUT", int64(c.Upstream.ConnectTimeout))
+	positive("ASSEMBLYAI_RECONNECT_BACKOFF", int64(c.Upstream.ReconnectBackoff))
+	positive("ASSEMBLYAI_RECONNECT_BUFFER", int64(c.Upstream.ReconnectBuffer))
+	if c.Upstream.ReconnectAttempts < 0 {
+		errs = append(errs, fmt.Errorf("ASSEMBLYAI_RECONNECT_ATTEMPTS must not be negative, got %d", c.Upstream.ReconnectAttempts))
+	}
+	if c.Upstream.ReconnectMaxBackoff < c.Upstream.ReconnectBackoff {
+		errs = append(errs, fmt.Errorf("ASSEMBLYAI_RECONNECT_MAX_BACKOFF must not be below ASSEMBLYAI_RECONNECT_BACKOFF, got %s", c.Upstream.ReconnectMaxBackoff))
+	}
+
+	positive("SESSION_MAX_LENGTH", int64(c.Session.MaxLength))
+	positive("SESSION_MAX_ERRORS", int64(c.Session.MaxErrors))
+	positive("SESSION_RESUME_GRACE_WINDOW", int64(c.Session.ResumeGraceWindow))
+	positive("SESSION_MAX_REPLAY_MESSAGES", int64(c.Session.MaxReplayMessages))
+	positive("SESSION_MAX_MESSAGE_BYTES", c.Session.MaxMessageBytes)
+	positive("SESSION_SAVE_TIMEOUT", int64(c.Session.SaveTimeout))
+	positive("SESSION_TOKEN_EXPIRY_WARNING", int64(c.Session.TokenExpiryWarning))
+	positive("SESSION_QUEUE_SIZE", int64(c.Session.QueueSize))
+	positive("SESSION_WRITE_TIMEOUT", int64(c.Session.WriteTimeout))
+	if c.Session.MaxConcurrent < 0 {
+		errs = append(errs, fmt.Errorf("SESSION_MAX_CONCURRENT must not be negative, got %d", c.Session.MaxConcurrent))
+	}
+	if !slices.Contains([]string{"reject", "takeover"}, c.Session.ConcurrentPolicy) {
+		errs = append(errs, fmt.Errorf("SESSION_CONCURRENT_POLICY: %q is not reject or takeover", c.Session.ConcurrentPolicy))
+	}
+	positive("ROOM_QUEUE_SIZE", int64(c.Room.QueueSize))
+	positive("ROOM_VIEWER_WRITE_TIMEOUT", int64(c.Room.ViewerWriteTimeout))
+	positive("ROOM_CLAIM_TIMEOUT", int64(c.Room.ClaimTimeout))
+	positive("DRAIN_TIMEOUT_SECONDS", int64(c.Drain.Timeout))
+	if c.Drain.TerminateBefore < 0 || c.Drain.TerminateBefore >= c.Drain.Timeout {
+		errs = append(errs, fmt.Errorf("DRAIN_TERMINATE_BEFORE must be between 0 and the drain timeout, got %s", c.Drain.TerminateBefore))
+	}
+
+	if !slices.Contains([]string{"downgrade", "refuse"}, c.Billing.PastDuePolicy) {
+		errs = append(errs, fmt.Errorf("BILLING_PAST_DUE_POLICY: %q is not downgrade or refuse", c.Billing.PastDuePolicy))
+	}
+
+	positive("RATE_LIMIT_IDLE_TIMEOUT", int64(c.RateLimit.IdleTimeout))
+	positive("HEALTH_CHECK_TIMEOUT", int64(c.Health.CheckTimeout))
+	positive("HEALTH_UPSTREAM_CHECK_INTERVAL", int64(c.Health.UpstreamCheckInterval))
+	if c.Metrics.Addr != "" {
+		if _, port, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("METRICS_ADDR: %q is not a host:port", c.Metrics.Addr))
+		} else if port == c.Port {
+			errs = append(errs, fmt.Errorf("METRICS_ADDR: port %s is the public PORT, metrics need their own", port))
+		}
+	}
+
+	switch c.Recording.Storage {
+	case "":
+	case "local":
+		required("RECORDING_DIR", c.Recording.Dir)
+	default:
+		errs = append(errs, fmt.Errorf("RECORDING_STORAGE: unknown storage %q", c.Recording.Storage))
+	}
+	return errs
+}
+
+func stringVar(field func(c *Config) *string) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		*field(c) = raw
+		return nil
+	}
+}
+
+func boolVar(field func(c *Config) *bool) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		if raw == "" {
+			*field(c) = false
+			return nil
+		}
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+func intVar(field func(c *Config) *int) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+func int64Var(field func(c *Config) *int64) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+// durationVar takes Go durations like 90s or 30m.
+func durationVar(field func(c *Config) *time.Duration) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 5m", raw)
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+// secondsVar takes a whole number of seconds, for settings that always were.
+func secondsVar(field func(c *Config) *time.Duration) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a number of seconds", raw)
+		}
+		*field(c) = time.Duration(v) * time.Second
+		return nil
+	}
+}
+
+// listVar takes comma separated values.
+func listVar(field func(c *Config) *[]string) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		values := make([]string, 0)
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*field(c) = values
+		return nil
+	}
+}
+
+// rateVar takes requests per second and burst as rate:burst, e.g. 0.5:5.
+func rateVar(field func(c *Config) *RateLimit) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		v, err := parseRate(raw)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+// routeRatesVar takes comma separated pattern=rate:burst, e.g. /ws=1:5,/ws/room=2:10.
+func routeRatesVar(field func(c *Config) *map[string]RateLimit) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		routes := make(map[string]RateLimit)
+		for _, entry := range strings.Split(raw, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			pattern, rate, ok := strings.Cut(entry, "=")
+			if !ok || strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("%q is not pattern=rate:burst", entry)
+			}
+			v, err := parseRate(rate)
+			if err != nil {
+				return err
+			}
+			routes[strings.TrimSpace(pattern)] = v
+		}
+		*field(c) = routes
+		return nil
+	}
+}
+
+func parseRate(raw string) (RateLimit, error) {
+	perSecond, burst, ok := strings.Cut(strings.TrimSpace(raw), ":")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("%q is not rate:burst", raw)
+	}
+	r, err := strconv.ParseFloat(perSecond, 64)
+	if err != nil || r <= 0 {
+		return RateLimit{}, fmt.Errorf("%q: rate must be a positive number", raw)
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil || b <= 0 {
+		return RateLimit{}, fmt.Errorf("%q: burst must be a positive integer", raw)
+	}
+	return RateLimit{PerSecond: r, Burst: b}, nil
+}
+
+// prefixListVar takes comma separated CIDR ranges or single addresses.
+func prefixListVar(field func(c *Config) *[]netip.Prefix) func(c *Config, raw string) error {
+	return func(c *Config, raw string) error {
+		prefixes := make([]netip.Prefix, 0)
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if !strings.Contains(v, "/") {
+				addr, err := netip.ParseAddr(v)
+				if err != nil {
+					return fmt.Errorf("%q is not an ip address or range", v)
+				}
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			prefix, err := netip.ParsePrefix(v)
+			if err != nil {
+				return fmt.Errorf("%q is not an ip address or range", v)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+		*field(c) = prefixes
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readFile reads the TOML subset the config file uses:
+//
+//	# comment
+//	port = "8080"
+//	allowed_origins = ["https://a.example", "https://b.example"]
+//	[session]
+//	max_length = "45m"
+//	max_errors = 10
+//	[features]
+//	rooms = false
+//
+// Keys come back as section.key, values as the strings the env vars would hold. Every bad line is
+// reported, the lines around it are still read; keys under a bad section header are skipped.
+func readFile(path string) (map[string]string, []error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to open config file: %w", err)}
+	}
+	defer f.Close()
+	return parseFile(f, path)
+}
+
+func parseFile(r io.Reader, name string) (map[string]string, []error) {
+	values := make(map[string]string)
+	var errs []error
+	section := ""
+	badSection := false
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			header, rest, ok := strings.Cut(line[1:], "]")
+			section = strings.TrimSpace(header)
+			badSection = !ok || section == "" || checkTrailing(rest) != nil
+			if badSection {
+				errs = append(errs, fmt.Errorf("%s:%d: invalid section header", name, lineNo))
+			}
+			continue
+		}
+		if badSection {
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			errs = append(errs, fmt.Errorf("%s:%d: expected key = value", name, lineNo))
+			continue
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %s: %w", name, lineNo, key, err))
+			continue
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to read config file: %w", err))
+	}
+	return values, errs
+}
+
+// parseValue unquotes strings, joins arrays with commas and drops trailing comments.
+func parseValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`) || strings.HasPrefix(raw, `'`):
+		value, rest, err := cutString(raw)
+		if err != nil {
+			return "", err
+		}
+		if err := checkTrailing(rest); err != nil {
+			return "", err
+		}
+		return value, nil
+
+	case strings.HasPrefix(raw, "["):
+		items := make([]string, 0)
+		rest := strings.TrimSpace(raw[1:])
+		for !strings.HasPrefix(rest, "]") {
+			if rest == "" {
+				return "", fmt.Errorf("unterminated array")
+			}
+			item, after, err := cutString(rest)
+			if err != nil {
+				return "", fmt.Errorf("arrays hold strings only: %w", err)
+			}
+			items = append(items, item)
+			rest = strings.TrimSpace(after)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return "", fmt.Errorf("expected , or ] in array")
+			}
+		}
+		if err := checkTrailing(rest[1:]); err != nil {
+			return "", err
+		}
+		return strings.Join(items, ","), nil
+	}
+
+	// numbers and booleans
+	if i := strings.Index(raw, "#"); i >= 0 {
+		raw = raw[:i]
+	}
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return value, nil
+}
+
+// cutString reads one quoted string at the start of s and returns what follows it.
+func cutString(s string) (string, string, error) {
+	if strings.HasPrefix(s, "'") {
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("expected a quoted string")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string: %w", err)
+			}
+			return value, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func checkTrailing(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after value", rest)
+	}
+	return nil
+}
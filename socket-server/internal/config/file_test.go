@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want map[string]string
+		// one entry per reported error, each a substring of it
+		errs []string
+	}{
+		{
+			name: "quoting",
+			file: `
+port = "8080"
+escaped = "a \"quoted\" \\ path\t"
+literal = 'C:\no\escapes'
+hash = "not # a comment"
+empty = ""
+`,
+			want: map[string]string{
+				"port":    "8080",
+				"escaped": "a \"quoted\" \\ path\t",
+				"literal": `C:\no\escapes`,
+				"hash":    "not # a comment",
+				"empty":   "",
+			},
+		},
+		{
+			name: "comments",
+			file: `
+# full line
+   # indented
+port = "8080" # after a string
+max_errors = 10 # after a number
+allowed_origins = ["https://a.example"] # after an array
+`,
+			want: map[string]string{
+				"port":            "8080",
+				"max_errors":      "10",
+				"allowed_origins": "https://a.example",
+			},
+		},
+		{
+			name: "sections",
+			file: `
+port = "8080"
+[session]
+max_errors = 10
+[ features ]
+rooms = false
+[upstream] # trailing comment
+api_key = "k"
+`,
+			want: map[string]string{
+				"port":               "8080",
+				"session.max_errors": "10",
+				"features.rooms":     "false",
+				"upstream.api_key":   "k",
+			},
+		},
+		{
+			name: "durations",
+			file: `
+[session]
+max_length = "45m"
+resume_grace_window = 90s
+`,
+			want: map[string]string{
+				"session.max_length":          "45m",
+				"session.resume_grace_window": "90s",
+			},
+		},
+		{
+			name: "arrays",
+			file: `
+allowed_origins = ["https://a.example", 'https://b.example',]
+empty = []
+`,
+			want: map[string]string{
+				"allowed_origins": "https://a.example,https://b.example",
+				"empty":           "",
+			},
+		},
+		{
+			name: "bad lines",
+			file: `
+port
+= "8080"
+host = "unterminated
+origins = ["a", "b",
+ids = [1, 2]
+name = "x" trailing
+missing =
+max_errors = 10
+`,
+			want: map[string]string{"max_errors": "10"},
+			errs: []string{
+				"test.toml:2: expected key = value",
+				"test.toml:3: expected key = value",
+				"test.toml:4: host: unterminated string",
+				"test.toml:5: origins: unterminated array",
+				"test.toml:6: ids: arrays hold strings only",
+				`test.toml:7: name: unexpected "trailing" after value`,
+				"test.toml:8: missing: missing value",
+			},
+		},
+		{
+			name: "bad section headers",
+			file: `
+[session
+max_errors = 10
+[]
+max_length = "45m"
+[features] rooms
+rooms = false
+[upstream]
+api_key = "k"
+`,
+			want: map[string]string{"upstream.api_key": "k"},
+			errs: []string{
+				"test.toml:2: invalid section header",
+				"test.toml:4: invalid section header",
+				"test.toml:6: invalid section header",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, errs := parseFile(strings.NewReader(tt.file), "test.toml")
+			if !maps.Equal(values, tt.want) {
+				t.Errorf("values = %v, want %v", values, tt.want)
+			}
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("got %d errors, want %d: %v", len(errs), len(tt.errs), errors.Join(errs...))
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.errs[i]) {
+					t.Errorf("error %d = %q, want it to contain %q", i, err, tt.errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	file := `
+port
+[session]
+max_length = "soon"
+max_errors = "unterminated
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "9090")
+	t.Setenv("METRICS_ADDR", ":9090")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load accepted a broken config file")
+	}
+	for _, want := range []string{
+		path + ":2: expected key = value",
+		path + ":5: session.max_errors: unterminated string",
+		"session.max_length:",
+		"METRICS_ADDR: port 9090 is the public PORT",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
@@ -1,61 +0,0 @@
-package config
-
-import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
-)
-
-type AppEnvVars struct {
-	Port              string
-	FrontendUrl       string
-	AssemblyApiKey    string
-	SupabaseJwtKey    string
-	DatabaseConnection string
-}
-
-var EnvVars *AppEnvVars
-
-func CheckingAllEnvVars() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Fatal("env var didnt load successfully")
-		}
-		port = os.Getenv("PORT")
-	}
-	frontendUrl := os.Getenv("FRONTEND_URL")
-	assemblyApiKey := os.Getenv("ASSEMBLYAI_API_KEY")
-	supabaseJwtKey := os.Getenv("SUPABASE_JWT_KEY")
-	databaseConnection := os.Getenv("DATABASE_URL")
-
-	if port == "" {
-		log.Fatal("fail to load PORT in env")
-	}
-	if frontendUrl == "" {
-		log.Fatal("fail to load FRONTEND_URL in env")
-	}
-	if assemblyApiKey == "" {
-		log.Fatal("fail to load ASSEMBLYAI_API_KEY in env")
-	}
-	if supabaseJwtKey == "" {
-		log.Fatal("fail to load SUPABASE_JWT_KEY in env")
-	}
-	if databaseConnection == "" {
-		log.Fatal("fail to load DATABASE_URL in env")
-	}
-
-	EnvVars = &AppEnvVars{
-		Port:              port,
-		FrontendUrl:       frontendUrl,
-		AssemblyApiKey:    assemblyApiKey,
-		SupabaseJwtKey:    supabaseJwtKey,
-		DatabaseConnection: databaseConnection,
-	}
-
-}
-
-
-
@@ -3,16 +3,17 @@ package database
 import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"os"
 )
 
 var DB *gorm.DB
 
-func Init() {
-	dsn :=  os.Getenv("DATABASE_URL")
+func Init(dsn string) {
 	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		panic(err)
 	}
+	if err := registerMetrics(conn); err != nil {
+		panic(err)
+	}
 	DB = conn
 }
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"meetingmind-socket/internal/metrics"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	queryDuration = metrics.NewHistogramVec("meetingmind_db_query_duration_seconds",
+		"Database statement latency by operation.", metrics.DefBuckets, "operation")
+	queryErrors = metrics.NewCounterVec("meetingmind_db_errors_total",
+		"Failed database statements by operation, missing rows excluded.", "operation")
+)
+
+const queryStartKey = "meetingmind:query_start"
+
+// registerMetrics times every gorm statement and exposes the pool usage.
+func registerMetrics(db *gorm.DB) error {
+	type processor struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}
+	cb := db.Callback()
+	processors := []processor{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, p := range processors {
+		operation := p.operation
+		if err := p.before("metrics:before_"+operation, func(tx *gorm.DB) {
+			tx.InstanceSet(queryStartKey, time.Now())
+		}); err != nil {
+			return err
+		}
+		if err := p.after("metrics:after_"+operation, func(tx *gorm.DB) {
+			if start, ok := tx.InstanceGet(queryStartKey); ok {
+				queryDuration.With(operation).Observe(time.Since(start.(time.Time)).Seconds())
+			}
+			if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+				queryErrors.With(operation).Inc()
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	metrics.NewGaugeFunc("meetingmind_db_open_connections", "Open connections in the database pool.", func() float64 {
+		return float64(sqlDB.Stats().OpenConnections)
+	})
+	metrics.NewGaugeFunc("meetingmind_db_in_use_connections", "Database connections currently in use.", func() float64 {
+		return float64(sqlDB.Stats().InUse)
+	})
+	return nil
+}
@@ -0,0 +1,18 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// Ping checks that the database answers.
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
@@ -0,0 +1,224 @@
+// Package fakeassembly is a local stand-in for AssemblyAI's v3 streaming API.
+// Point ASSEMBLYAI_BASE_URL at it to run the socket server offline.
+package fakeassembly
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Step is one scripted upstream message.
+// It is emitted once the session has received AfterBytes of audio in total.
+type Step struct {
+	AfterBytes int             `json:"after_bytes"`
+	Message    json.RawMessage `json:"message"`
+}
+
+// Script drives one streaming session: Begin on connect, the steps in order,
+// then Termination once the client sends Terminate or, with TerminateAtEnd, after the last step.
+type Script struct {
+	Steps          []Step `json:"steps"`
+	TerminateAtEnd bool   `json:"terminate_at_end"`
+}
+
+func LoadFixture(name string) (Script, error) {
+	data, err := fixtures.ReadFile("fixtures/" + name + ".json")
+	if err != nil {
+		return Script{}, fmt.Errorf("unknown fixture %q: %w", name, err)
+	}
+	return ParseScript(data)
+}
+
+func ParseScript(data []byte) (Script, error) {
+	var script Script
+	if err := json.Unmarshal(data, &script); err != nil {
+		return Script{}, fmt.Errorf("cant parse script: %w", err)
+	}
+	return script, nil
+}
+
+type Server struct {
+	ApiKey string
+	Script Script
+
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	issued   int
+	sessions int
+	models   []string
+	// the next drops sessions break off after dropAfter bytes of audio
+	drops     int
+	dropAfter int
+}
+
+func NewServer(apiKey string, script Script) *Server {
+	return &Server{
+		ApiKey: apiKey,
+		Script: script,
+		tokens: make(map[string]time.Time),
+	}
+}
+
+// Start serves the fake on a random local port, the caller must Close it.
+func Start(apiKey string, script Script) (*httptest.Server, *Server) {
+	fake := NewServer(apiKey, script)
+	return httptest.NewServer(fake), fake
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v3/token":
+		s.handleToken(w, r)
+	case "/v3/ws":
+		s.handleStream(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// DropStreams makes the next n streaming sessions break off without a Termination once they
+// received afterBytes of audio, the way a provider connection drops mid-session.
+func (s *Server) DropStreams(n int, afterBytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops = n
+	s.dropAfter = afterBytes
+}
+
+// Models reports the speech_model every streaming session was opened with, in order.
+func (s *Server) Models() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.models)
+}
+
+// Sessions reports how many streaming sessions have been opened.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if s.ApiKey != "" && r.Header.Get("Authorization") != s.ApiKey {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+		return
+	}
+	expires, err := strconv.Atoi(r.URL.Query().Get("expires_in_seconds"))
+	if err != nil || expires <= 0 {
+		http.Error(w, `{"error":"invalid expires_in_seconds"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.issued++
+	token := fmt.Sprintf("fake-token-%d", s.issued)
+	s.tokens[token] = time.Now().Add(time.Duration(expires) * time.Second)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"token":              token,
+		"expires_in_seconds": expires,
+	})
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	s.mu.Lock()
+	expiresAt, ok := s.tokens[token]
+	dropAfter := 0
+	if ok {
+		// streaming tokens are single use
+		delete(s.tokens, token)
+		s.sessions++
+		s.models = append(s.models, r.URL.Query().Get("speech_model"))
+		if s.drops > 0 {
+			s.drops--
+			dropAfter = s.dropAfter
+		}
+	}
+	s.mu.Unlock()
+	if !ok || time.Now().After(expiresAt) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("fake assembly upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	sessionStart := time.Now()
+	conn.WriteJSON(map[string]any{
+		"type":       "Begin",
+		"id":         fmt.Sprintf("fake-session-%d", s.Sessions()),
+		"expires_at": expiresAt.Unix(),
+	})
+
+	received := 0
+	next := 0
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if msgType == websocket.TextMessage {
+			var control struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(msg, &control) == nil && control.Type == "Terminate" {
+				writeTermination(conn, received, sessionStart)
+				return
+			}
+			continue
+		}
+
+		received += len(msg)
+		for next < len(s.Script.Steps) && s.Script.Steps[next].AfterBytes <= received {
+			if err := conn.WriteMessage(websocket.TextMessage, s.Script.Steps[next].Message); err != nil {
+				return
+			}
+			next++
+		}
+
+		if s.Script.TerminateAtEnd && next == len(s.Script.Steps) {
+			writeTermination(conn, received, sessionStart)
+			return
+		}
+		if dropAfter > 0 && received >= dropAfter {
+			slog.Info("fake assembly dropping the stream", "received", received)
+			return
+		}
+	}
+}
+
+func writeTermination(conn *websocket.Conn, received int, sessionStart time.Time) {
+	// 16kHz 16-bit mono
+	audioSeconds := float64(received) / (16000 * 2)
+	conn.WriteJSON(map[string]any{
+		"type":                     "Termination",
+		"audio_duration_seconds":   audioSeconds,
+		"session_duration_seconds": time.Since(sessionStart).Seconds(),
+	})
+}
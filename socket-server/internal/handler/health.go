@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check tells whether one dependency works, it should give up when ctx is done.
+// A check with CacheFor set reruns at most that often, for dependencies that cost money
+// or rate limits to ask, like minting an upstream token.
+type Check struct {
+	Name     string
+	Run      func(ctx context.Context) error
+	CacheFor time.Duration
+}
+
+type CheckResult struct {
+	Status    string    `json:"status"`
+	LatencyMs float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Cached    bool      `json:"cached,omitempty"`
+}
+
+// cachedCheck keeps the last result of a check with CacheFor.
+type cachedCheck struct {
+	Check
+	mu   sync.Mutex
+	last CheckResult
+}
+
+func (c *cachedCheck) run(ctx context.Context) CheckResult {
+	if c.CacheFor <= 0 {
+		return runCheck(ctx, c.Check)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < c.CacheFor {
+		result := c.last
+		result.Cached = true
+		return result
+	}
+	c.last = runCheck(ctx, c.Check)
+	return c.last
+}
+
+type healthResponse struct {
+	Status        string                 `json:"status"`
+	UptimeSeconds float64                `json:"uptimeSeconds"`
+	Draining      bool                   `json:"draining,omitempty"`
+	Checks        map[string]CheckResult `json:"checks,omitempty"`
+}
+
+var startedAt = time.Now()
+
+// Healthz answers as long as the process serves http, orchestrators restart it when it doesn't.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok", UptimeSeconds: time.Since(startedAt).Seconds()})
+	}
+}
+
+// Readyz runs every check in parallel and answers 503 when one fails or the server is draining,
+// so the load balancer stops sending new sessions.
+func Readyz(timeout time.Duration, draining func() bool, checks ...Check) http.HandlerFunc {
+	states := make([]*cachedCheck, len(checks))
+	for i, check := range checks {
+		states[i] = &cachedCheck{Check: check}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		results := make(map[string]CheckResult, len(checks))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, check := range states {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := check.run(ctx)
+				mu.Lock()
+				results[check.Name] = result
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		resp := healthResponse{
+			Status:        "ok",
+			UptimeSeconds: time.Since(startedAt).Seconds(),
+			Draining:      draining(),
+			Checks:        results,
+		}
+		for _, result := range results {
+			if result.Status != "ok" {
+				resp.Status = "unavailable"
+			}
+		}
+		if resp.Draining {
+			resp.Status = "draining"
+		}
+
+		code := http.StatusOK
+		if resp.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, resp)
+	}
+}
+
+func runCheck(ctx context.Context, check Check) CheckResult {
+	start := time.Now()
+	err := check.Run(ctx)
+	result := CheckResult{
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func writeHealth(w http.ResponseWriter, code int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
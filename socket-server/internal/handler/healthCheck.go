@@ -1,14 +1,12 @@
 package handler
 
 import (
-	"net/http"
-	"os"
 	"fmt"
+	"net/http"
 )
 
-func HealthCheck() http.HandlerFunc{
+func HealthCheck(frontendURL string) http.HandlerFunc {
 	return (func(w http.ResponseWriter, r *http.Request) {
-		frontendURL := os.Getenv("FRONTEND_URL")
 		w.Header().Set("Access-Control-Allow-Origin", frontendURL)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func readyz(t *testing.T, h http.HandlerFunc) (int, healthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var resp healthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, resp
+}
+
+func passing(ctx context.Context) error { return nil }
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		draining   bool
+		checks     []Check
+		wantCode   int
+		wantStatus string
+	}{
+		{
+			name:       "all checks pass",
+			checks:     []Check{{Name: "database", Run: passing}, {Name: "upstream", Run: passing}},
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+		},
+		{
+			name: "a check fails",
+			checks: []Check{
+				{Name: "database", Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+				{Name: "upstream", Run: passing},
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+		},
+		{
+			name: "a check outlives the timeout",
+			checks: []Check{{Name: "database", Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}}},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+		},
+		{
+			name:       "draining",
+			draining:   true,
+			checks:     []Check{{Name: "database", Run: passing}},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "draining",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draining := func() bool { return tt.draining }
+			code, resp := readyz(t, Readyz(50*time.Millisecond, draining, tt.checks...))
+			if code != tt.wantCode || resp.Status != tt.wantStatus {
+				t.Errorf("got %d %q, want %d %q", code, resp.Status, tt.wantCode, tt.wantStatus)
+			}
+			if len(resp.Checks) != len(tt.checks) {
+				t.Errorf("got results %v, want one per check", resp.Checks)
+			}
+			if resp.Draining != tt.draining {
+				t.Errorf("draining %v, want %v", resp.Draining, tt.draining)
+			}
+		})
+	}
+}
+
+func TestReadyzCachesCheck(t *testing.T) {
+	var upstreamRuns, databaseRuns atomic.Int32
+	h := Readyz(time.Second, func() bool { return false },
+		Check{Name: "database", Run: func(ctx context.Context) error {
+			databaseRuns.Add(1)
+			return nil
+		}},
+		Check{Name: "upstream", CacheFor: 100 * time.Millisecond, Run: func(ctx context.Context) error {
+			upstreamRuns.Add(1)
+			return errors.New("token endpoint down")
+		}},
+	)
+
+	code, resp := readyz(t, h)
+	if code != http.StatusServiceUnavailable || resp.Checks["upstream"].Cached {
+		t.Fatalf("first call: %d %+v", code, resp.Checks["upstream"])
+	}
+	// a cached failure still fails the probe
+	code, resp = readyz(t, h)
+	if code != http.StatusServiceUnavailable || !resp.Checks["upstream"].Cached || resp.Checks["upstream"].Error != "token endpoint down" {
+		t.Errorf("second call: %d %+v, want the cached failure", code, resp.Checks["upstream"])
+	}
+	if n := upstreamRuns.Load(); n != 1 {
+		t.Errorf("upstream checked %d times within CacheFor, want 1", n)
+	}
+	if n := databaseRuns.Load(); n != 2 {
+		t.Errorf("database checked %d times, want every call", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, resp = readyz(t, h); resp.Checks["upstream"].Cached {
+		t.Error("result served from the cache past CacheFor")
+	}
+	if n := upstreamRuns.Load(); n != 2 {
+		t.Errorf("upstream checked %d times, want a rerun past CacheFor", n)
+	}
+}
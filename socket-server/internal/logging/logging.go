@@ -0,0 +1,42 @@
+// Package logging sets up the process wide slog logger.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// New builds a logger writing to w, level is debug|info|warn|error and format text|json.
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case FORMAT_TEXT:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+}
+
+// Setup makes a stderr logger the default one, the standard log package writes through it too.
+func Setup(level string, format string) error {
+	logger, err := New(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
@@ -0,0 +1,326 @@
+// Package metrics is a small Prometheus text exposition registry,
+// enough for counters, gauges and histograms with labels.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the Prometheus default latency buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	byName map[string]collector
+}{byName: make(map[string]collector)}
+
+func register(c collector) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.byName[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry.byName[c.name()] = c
+}
+
+// Handler serves every registered metric in the text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+func WriteTo(w io.Writer) {
+	registry.Lock()
+	collectors := make([]collector, 0, len(registry.byName))
+	for _, c := range registry.byName {
+		collectors = append(collectors, c)
+	}
+	registry.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// family holds the children of one metric, one per set of label values.
+type family[T any] struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+	newChild   func() *T
+
+	mu       sync.Mutex
+	children map[string]*T
+	values   map[string][]string
+}
+
+func newFamily[T any](name string, help string, kind string, labelNames []string, newChild func() *T) *family[T] {
+	return &family[T]{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		newChild:   newChild,
+		children:   make(map[string]*T),
+		values:     make(map[string][]string),
+	}
+}
+
+func (f *family[T]) name() string { return f.metricName }
+
+func (f *family[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	child, ok := f.children[key]
+	if !ok {
+		child = f.newChild()
+		f.children[key] = child
+		f.values[key] = append([]string(nil), labelValues...)
+	}
+	return child
+}
+
+// each calls fn for every child sorted by labels.
+func (f *family[T]) each(fn func(labels string, child *T)) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]*T, len(keys))
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		children[i] = f.children[k]
+		labels[i] = formatLabels(f.labelNames, f.values[k])
+	}
+	f.mu.Unlock()
+
+	for i := range keys {
+		fn(labels[i], children[i])
+	}
+}
+
+func (f *family[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, f.kind)
+}
+
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add panics on a negative value, counters only go up.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter can't decrease")
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) Value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+type CounterVec struct {
+	*family[Counter]
+}
+
+func NewCounter(name string, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{newFamily(name, help, "counter", labelNames, func() *Counter { return &Counter{} })}
+	register(v)
+	return v
+}
+
+func (v *CounterVec) With(labelValues ...string) *Counter { return v.with(labelValues) }
+
+func (v *CounterVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(labels string, c *Counter) {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, labels, formatFloat(c.Value()))
+	})
+}
+
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+func (g *Gauge) Add(v float64) { addFloat(&g.bits, v) }
+func (g *Gauge) Inc()          { g.Add(1) }
+func (g *Gauge) Dec()          { g.Add(-1) }
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+type GaugeVec struct {
+	*family[Gauge]
+}
+
+func NewGauge(name string, help string) *Gauge {
+	return NewGaugeVec(name, help).With()
+}
+
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	v := &GaugeVec{newFamily(name, help, "gauge", labelNames, func() *Gauge { return &Gauge{} })}
+	register(v)
+	return v
+}
+
+func (v *GaugeVec) With(labelValues ...string) *Gauge { return v.with(labelValues) }
+
+func (v *GaugeVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(labels string, g *Gauge) {
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, labels, formatFloat(g.Value()))
+	})
+}
+
+// gaugeFunc reads its value when scraped, for state that is already tracked elsewhere.
+type gaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+func NewGaugeFunc(name string, help string, fn func() float64) {
+	register(&gaugeFunc{metricName: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) name() string { return g.metricName }
+
+func (g *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.metricName, escapeHelp(g.help), g.metricName)
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+type Histogram struct {
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+type HistogramVec struct {
+	*family[Histogram]
+}
+
+func NewHistogram(name string, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	v := &HistogramVec{newFamily(name, help, "histogram", labelNames, func() *Histogram {
+		return &Histogram{upperBounds: bounds, counts: make([]uint64, len(bounds))}
+	})}
+	register(v)
+	return v
+}
+
+func (v *HistogramVec) With(labelValues ...string) *Histogram { return v.with(labelValues) }
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(labels string, h *Histogram) {
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		count, sum := h.count, h.sum
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.metricName, withLabel(labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.metricName, withLabel(labels, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.metricName, labels, formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.metricName, labels, count)
+	})
+}
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds one more label to already formatted labels.
+func withLabel(labels string, name string, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
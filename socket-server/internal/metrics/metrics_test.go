@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestWriteTo checks the exposition of every metric kind against testdata/exposition.golden,
+// run with -update after a deliberate format change.
+func TestWriteTo(t *testing.T) {
+	useEmptyRegistry(t)
+
+	requests := NewCounterVec("test_requests_total", "Requests by route and status.", "route", "status")
+	requests.With("/ws", "200").Add(3)
+	requests.With("/rooms", "403").Inc()
+	requests.With(`C:\path "quoted"`+"\nnext", "500").Inc()
+
+	NewCounter("test_escaped_help_total", "A help text with a \\ backslash\nand a second line.").Add(0.5)
+
+	sessions := NewGaugeVec("test_sessions", "Sessions by plan.", "plan")
+	sessions.With("PRO").Set(2)
+	sessions.With("FREE").Inc()
+	sessions.With("FREE").Dec()
+
+	NewGaugeFunc("test_draining", "Whether the server is draining.", func() float64 { return 1 })
+
+	// bounds are sorted, a value on a bound falls in that bucket
+	latency := NewHistogramVec("test_latency_seconds", "Latency by stream.", []float64{1, 0.1, 0.5}, "stream")
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		latency.With("transcript").Observe(v)
+	}
+	latency.With("translate").Observe(0.5)
+
+	NewHistogram("test_size_bytes", "Sizes, no observations.", []float64{100, 1000})
+
+	var got bytes.Buffer
+	WriteTo(&got)
+
+	golden := "testdata/exposition.golden"
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("exposition differs from %s\ngot:\n%s\nwant:\n%s", golden, got.Bytes(), want)
+	}
+}
+
+// useEmptyRegistry lets a test register its own metrics, the registry is restored when it ends.
+func useEmptyRegistry(t *testing.T) {
+	registry.Lock()
+	saved := registry.byName
+	registry.byName = make(map[string]collector)
+	registry.Unlock()
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.byName = saved
+		registry.Unlock()
+	})
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+)
+
+// RegisterRuntime adds the go_* and process_* metrics the official Prometheus client exports,
+// under the same names so the usual Go dashboards and alerts work as they are.
+func RegisterRuntime() {
+	register(goCollector{})
+	register(processCollector{})
+}
+
+// writeSample writes one unlabelled metric with its header.
+func writeSample(w io.Writer, name string, help string, kind string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, escapeHelp(help), name, kind, name, formatFloat(v))
+}
+
+// goCollector reads the Go runtime once per scrape.
+type goCollector struct{}
+
+func (goCollector) name() string { return "go" }
+
+func (goCollector) write(w io.Writer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	writeSample(w, "go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine()))
+	writeSample(w, "go_threads", "Number of OS threads created.", "gauge", float64(pprof.Lookup("threadcreate").Count()))
+	writeSample(w, "go_sched_gomaxprocs_threads", "The current runtime.GOMAXPROCS setting.", "gauge", float64(runtime.GOMAXPROCS(0)))
+	fmt.Fprintf(w, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info%s 1\n",
+		formatLabels([]string{"version"}, []string{runtime.Version()}))
+
+	writeSample(w, "go_memstats_alloc_bytes", "Number of bytes allocated in heap and currently in use.", "gauge", float64(m.Alloc))
+	writeSample(w, "go_memstats_alloc_bytes_total", "Total number of bytes allocated in heap until now, even if released already.", "counter", float64(m.TotalAlloc))
+	writeSample(w, "go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge", float64(m.Sys))
+	writeSample(w, "go_memstats_mallocs_total", "Total number of heap objects allocated.", "counter", float64(m.Mallocs))
+	writeSample(w, "go_memstats_frees_total", "Total number of heap objects frees.", "counter", float64(m.Frees))
+	writeSample(w, "go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and currently in use.", "gauge", float64(m.HeapAlloc))
+	writeSample(w, "go_memstats_heap_sys_bytes", "Number of heap bytes obtained from system.", "gauge", float64(m.HeapSys))
+	writeSample(w, "go_memstats_heap_idle_bytes", "Number of heap bytes waiting to be used.", "gauge", float64(m.HeapIdle))
+	writeSample(w, "go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge", float64(m.HeapInuse))
+	writeSample(w, "go_memstats_heap_released_bytes", "Number of heap bytes released to OS.", "gauge", float64(m.HeapReleased))
+	writeSample(w, "go_memstats_heap_objects", "Number of currently allocated objects.", "gauge", float64(m.HeapObjects))
+	writeSample(w, "go_memstats_stack_inuse_bytes", "Number of bytes obtained from system for stack allocator in non-CGO environments.", "gauge", float64(m.StackInuse))
+	writeSample(w, "go_memstats_next_gc_bytes", "Number of heap bytes when next garbage collection will take place.", "gauge", float64(m.NextGC))
+	writeSample(w, "go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", "gauge", float64(m.LastGC)/1e9)
+	writeSample(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(m.NumGC))
+	writeSample(w, "go_gc_pause_seconds_total", "Total time the world was stopped for garbage collection.", "counter", float64(m.PauseTotalNs)/1e9)
+}
+
+// processCollector reads /proc, elsewhere it writes nothing.
+type processCollector struct{}
+
+func (processCollector) name() string { return "process" }
+
+// userHZ is the unit of the cpu times in /proc, 100 on every Linux the server runs on.
+const userHZ = 100
+
+func (processCollector) write(w io.Writer) {
+	stat, err := readProcStat()
+	if err != nil {
+		return
+	}
+	writeSample(w, "process_cpu_seconds_total", "Total user and system CPU time spent in seconds.", "counter", float64(stat.utime+stat.stime)/userHZ)
+	writeSample(w, "process_resident_memory_bytes", "Resident memory size in bytes.", "gauge", float64(stat.rss*int64(os.Getpagesize())))
+	writeSample(w, "process_virtual_memory_bytes", "Virtual memory size in bytes.", "gauge", float64(stat.vsize))
+	if boot, err := bootTime(); err == nil {
+		writeSample(w, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge", float64(boot)+float64(stat.starttime)/userHZ)
+	}
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		writeSample(w, "process_open_fds", "Number of open file descriptors.", "gauge", float64(len(fds)))
+	}
+	if maxFds, err := maxOpenFiles(); err == nil {
+		writeSample(w, "process_max_fds", "Maximum number of open file descriptors.", "gauge", float64(maxFds))
+	}
+}
+
+type procStat struct {
+	utime, stime, starttime int64
+	vsize, rss              int64
+}
+
+// readProcStat parses the fields of /proc/self/stat the collector needs, see proc(5).
+func readProcStat() (procStat, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return procStat{}, err
+	}
+	// the command name may hold spaces and parentheses, the fields start after its last ')'
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return procStat{}, fmt.Errorf("unexpected /proc/self/stat: %q", data)
+	}
+	// fields[0] is field 3 of proc(5), the state
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("unexpected /proc/self/stat: %q", data)
+	}
+	var stat procStat
+	for _, f := range []struct {
+		index int
+		into  *int64
+	}{
+		{11, &stat.utime},
+		{12, &stat.stime},
+		{19, &stat.starttime},
+		{20, &stat.vsize},
+		{21, &stat.rss},
+	} {
+		if *f.into, err = strconv.ParseInt(fields[f.index], 10, 64); err != nil {
+			return procStat{}, fmt.Errorf("unexpected /proc/self/stat: %w", err)
+		}
+	}
+	return stat, nil
+}
+
+// bootTime is the btime line of /proc/stat, in seconds since the epoch.
+func bootTime() (int64, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no btime in /proc/stat")
+}
+
+// maxOpenFiles is the soft limit of "Max open files" in /proc/self/limits.
+func maxOpenFiles() (int64, error) {
+	data, err := os.ReadFile("/proc/self/limits")
+	if err != nil {
+		return 0, err
+	}
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Max open files"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				break
+			}
+			return strconv.ParseInt(fields[0], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no open files limit in /proc/self/limits")
+}
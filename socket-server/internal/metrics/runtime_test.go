@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// samples parses the unlabelled samples of an exposition.
+func samples(exposition string) map[string]float64 {
+	values := make(map[string]float64)
+	for line := range strings.SplitSeq(exposition, "\n") {
+		name, value, ok := strings.Cut(line, " ")
+		if !ok || strings.HasPrefix(line, "#") || strings.Contains(name, "{") {
+			continue
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+func TestRegisterRuntime(t *testing.T) {
+	useEmptyRegistry(t)
+	RegisterRuntime()
+
+	var out bytes.Buffer
+	WriteTo(&out)
+	got := samples(out.String())
+
+	positive := []string{"go_goroutines", "go_threads", "go_memstats_alloc_bytes", "go_memstats_heap_inuse_bytes", "go_memstats_sys_bytes"}
+	if _, err := os.Stat("/proc/self/stat"); err == nil {
+		// a test binary may not have used a tick of cpu yet
+		if _, ok := got["process_cpu_seconds_total"]; !ok {
+			t.Error("process_cpu_seconds_total is missing")
+		}
+		positive = append(positive, "process_resident_memory_bytes", "process_virtual_memory_bytes",
+			"process_start_time_seconds", "process_open_fds", "process_max_fds")
+	}
+	for _, name := range positive {
+		if got[name] <= 0 {
+			t.Errorf("%s = %v, want a positive value", name, got[name])
+		}
+	}
+	if !strings.Contains(out.String(), `go_info{version="go`) {
+		t.Error("go_info is missing")
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	stat, err := readProcStat()
+	if os.IsNotExist(err) {
+		t.Skip("no /proc")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.rss <= 0 || stat.vsize < stat.rss || stat.starttime <= 0 {
+		t.Errorf("stat %+v", stat)
+	}
+}
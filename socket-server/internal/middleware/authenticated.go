@@ -2,34 +2,107 @@ package middleware
 
 import (
 	"context"
-	"meetingmind-socket/internal/config"
 	"meetingmind-socket/internal/validation"
 	"net/http"
+	"slices"
 	"strings"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "No auth header", http.StatusUnauthorized)
-			return
-		}
-
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
-			return
-		}
-
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-
-		userID, err := validation.ValidateSupabaseJWT(token, config.EnvVars.SupabaseJwtKey)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+type claimsKey struct{}
+
+// identity holds the claims of a verified token together with the token they came from.
+type identity struct {
+	token  string
+	claims *validation.Claims
+}
+
+func withIdentity(r *http.Request, token string, claims *validation.Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, identity{token: token, claims: claims}))
+}
+
+// Claims are the token claims AuthMiddleware or IdentifyUser verified, nil for anonymous requests.
+func Claims(r *http.Request) *validation.Claims {
+	id, _ := r.Context().Value(claimsKey{}).(identity)
+	return id.claims
+}
+
+// VerifiedClaims are the claims of token when a middleware already verified that very token,
+// nil otherwise, so handlers don't check the signature of one token twice.
+func VerifiedClaims(r *http.Request, token string) *validation.Claims {
+	id, _ := r.Context().Value(claimsKey{}).(identity)
+	if token == "" || id.token != token {
+		return nil
+	}
+	return id.claims
+}
+
+// UserID is the user AuthMiddleware or IdentifyUser found, empty for anonymous requests.
+func UserID(r *http.Request) string {
+	if claims := Claims(r); claims != nil {
+		return claims.UserID()
+	}
+	return ""
+}
+
+func AuthMiddleware(verifier *validation.Verifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "No auth header", http.StatusUnauthorized)
+				return
+			}
+
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+				return
+			}
+
+			token := strings.TrimPrefix(authHeader, "Bearer ")
+			if VerifiedClaims(r, token) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := verifier.Verify(token)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, withIdentity(r, token, claims))
+		})
+	}
+}
+
+// IdentifyUser notes who is calling from a valid bearer token or ?token= query, the way websockets
+// authenticate, so the rate limiter can key on the user. It never refuses, handlers still authenticate
+// and reuse the claims through VerifiedClaims. It goes after the ip limit, see RateLimiter.
+func IdentifyUser(verifier *validation.Verifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("token")
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				token = bearer
+			}
+			if token != "" {
+				if claims, err := verifier.Verify(token); err == nil {
+					r = withIdentity(r, token, claims)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUsers lets only the listed users through, it goes after AuthMiddleware.
+func RequireUsers(userIDs []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(userIDs, UserID(r)) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
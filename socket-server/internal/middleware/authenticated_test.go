@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/validation"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testVerifier(t *testing.T) *validation.Verifier {
+	t.Helper()
+	v, err := validation.NewVerifier("test-secret", config.Default().Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func testToken(t *testing.T, userId string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  userId,
+		"aud":  "authenticated",
+		"role": "authenticated",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	verifier := testVerifier(t)
+	token := testToken(t, "user-1")
+
+	tests := []struct {
+		name     string
+		header   string
+		query    string
+		wantCode int
+		wantUser string
+	}{
+		{name: "bearer token", header: "Bearer " + token, wantCode: http.StatusOK, wantUser: "user-1"},
+		{name: "no header", wantCode: http.StatusUnauthorized},
+		{name: "not a bearer", header: "Basic dXNlcjpwYXNz", wantCode: http.StatusUnauthorized},
+		{name: "invalid token", header: "Bearer " + token + "x", wantCode: http.StatusUnauthorized},
+		// IdentifyUser takes ?token=, the routes behind AuthMiddleware don't
+		{name: "query token only", query: "?token=" + token, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { gotUser = UserID(r) }),
+				IdentifyUser(verifier), AuthMiddleware(verifier))
+			r := httptest.NewRequest("GET", "/rooms"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.wantCode || gotUser != tt.wantUser {
+				t.Errorf("got %d for %q, want %d for %q", rec.Code, gotUser, tt.wantCode, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestVerifiedClaimsOnlyForTheSameToken(t *testing.T) {
+	verifier := testVerifier(t)
+	token := testToken(t, "user-1")
+
+	var r *http.Request
+	h := IdentifyUser(verifier)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { r = req }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ws?token="+token, nil))
+
+	if claims := VerifiedClaims(r, token); claims == nil || claims.UserID() != "user-1" {
+		t.Fatalf("claims of the verified token: %+v", claims)
+	}
+	if claims := VerifiedClaims(r, testToken(t, "user-2")); claims != nil {
+		t.Errorf("claims of another token: %+v", claims)
+	}
+	if claims := VerifiedClaims(r, ""); claims != nil {
+		t.Errorf("claims without a token: %+v", claims)
+	}
+}
@@ -0,0 +1,13 @@
+package middleware
+
+import "net/http"
+
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h so a request goes through middlewares in the order given.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{
+			name:       "untrusted peer spoofing X-Forwarded-For",
+			remoteAddr: "203.0.113.7:5000",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer spoofing X-Real-IP",
+			remoteAddr: "203.0.113.7:5000",
+			realIP:     "198.51.100.1",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "one trusted proxy",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted hops are walked from the right",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"198.51.100.1, 203.0.113.7, 10.0.0.9"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "hops over several headers",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"198.51.100.1", "203.0.113.7", "10.0.0.9"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "every hop trusted falls back to X-Real-IP",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"10.0.0.8, 10.0.0.9"},
+			realIP:     "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "unparsable hop falls back to X-Real-IP",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"198.51.100.1, unknown"},
+			realIP:     "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Real-IP without X-Forwarded-For",
+			remoteAddr: "10.0.0.2:5000",
+			realIP:     " 203.0.113.7 ",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy without headers",
+			remoteAddr: "10.0.0.2:5000",
+			realIP:     "not an ip",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "ipv4-mapped peer and hop",
+			remoteAddr: "[::ffff:10.0.0.2]:5000",
+			forwarded:  []string{"::ffff:203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "ipv6 trusted proxy",
+			remoteAddr: "[2001:db8::1]:5000",
+			forwarded:  []string{"2600::7, 2001:db8:ffff::1"},
+			want:       "2600::7",
+		},
+		{name: "remote address without a port", remoteAddr: "203.0.113.7", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, hops := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", hops)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := realIP(r, trusted); got != tt.want {
+				t.Errorf("realIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,30 @@
 package middleware
 
 import (
-    "log"
-    "net/http"
-    "time"
+	"log/slog"
+	"net/http"
+	"time"
 )
 
+// Logger logs every request once it is done, websocket requests once the upgrade handler returns.
 func Logger(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        start := time.Now()
-        next.ServeHTTP(w, r)
-        log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
-    })
-}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
 
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.Status(),
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+			"client_ip", ClientIP(r),
+		)
+	})
+}
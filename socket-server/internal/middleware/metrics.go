@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"meetingmind-socket/internal/metrics"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("meetingmind_http_requests_total",
+		"HTTP requests by route and status code.", "route", "code")
+	httpDuration = metrics.NewHistogramVec("meetingmind_http_request_duration_seconds",
+		"HTTP request latency by route, websocket routes measure until the upgrade.", metrics.DefBuckets, "route")
+	rateLimited = metrics.NewCounterVec("meetingmind_http_rate_limited_total",
+		"Requests refused with 429 by route.", "route")
+	rateLimiterEntries = metrics.NewGauge("meetingmind_rate_limiter_entries",
+		"Client ip and user buckets the rate limiter keeps.")
+)
+
+// Metrics counts requests by the ServeMux pattern they matched, so unknown paths share one label.
+// It has to wrap the mux without a middleware in between that replaces the request, the mux sets
+// the pattern on the request it is given.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.With(route, strconv.Itoa(rec.Status())).Inc()
+		httpDuration.With(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code and body size, it still lets websockets hijack the connection.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
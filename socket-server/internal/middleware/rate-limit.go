@@ -1,37 +1,103 @@
 package middleware
 
 import (
+	"math"
+	"meetingmind-socket/internal/config"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
-	"sync"
 )
 
-var clients = make(map[string]*rate.Limiter)
-var clientsMu sync.Mutex
+// RateLimiter keeps a token bucket per route and client ip, and per route and user
+// once IdentifyUser knows who is calling. Buckets unused for IdleTimeout are dropped.
+// The ip bucket goes first so a flood of requests is refused before any token is verified:
+//
+//	Chain(h, limiter.ByIP(route), IdentifyUser(verifier), limiter.ByUser(route))
+type RateLimiter struct {
+	cfg config.RateLimitConfig
 
-func getLimiter(ip string) *rate.Limiter {
-	clientsMu.Lock()
-	defer clientsMu.Unlock()
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	lastSweep time.Time
+}
 
-	if limiter, exists := clients[ip]; exists {
-		return limiter
-	}
-	limiter := rate.NewLimiter(1, 5) // 1 request/sec, burst 5
-	clients[ip] = limiter
-	return limiter
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
 }
 
-func RateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		limiter := getLimiter(ip)
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{cfg: cfg, entries: make(map[string]*limiterEntry), lastSweep: time.Now()}
+}
 
-		if !limiter.Allow() {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
-		}
+// ByIP applies the limit of route, the ServeMux pattern it is registered on, per client ip.
+func (l *RateLimiter) ByIP(route string) Middleware {
+	return l.limit(route, func(r *http.Request) string { return "ip|" + ClientIP(r) })
+}
 
-		next.ServeHTTP(w, r)
+// ByUser applies the limit of route per user, anonymous requests only count against their ip.
+func (l *RateLimiter) ByUser(route string) Middleware {
+	return l.limit(route, func(r *http.Request) string {
+		if userId := UserID(r); userId != "" {
+			return "user|" + userId
+		}
+		return ""
 	})
 }
+
+func (l *RateLimiter) limit(route string, key func(r *http.Request) string) Middleware {
+	if !l.cfg.Enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	limit, ok := l.cfg.Routes[route]
+	if !ok {
+		limit = l.cfg.Default
+	}
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / limit.PerSecond)))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if k := key(r); k != "" && !l.allow(route+"|"+k, limit) {
+				rateLimited.With(route).Inc()
+				w.Header().Set("Retry-After", retryAfter)
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *RateLimiter) allow(key string, limit config.RateLimit) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) >= l.cfg.IdleTimeout {
+		l.sweep(now)
+	}
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &limiterEntry{limiter: rate.NewLimiter(rate.Limit(limit.PerSecond), limit.Burst)}
+		l.entries[key] = entry
+		rateLimiterEntries.Set(float64(len(l.entries)))
+	}
+	entry.lastSeen = now
+	l.mu.Unlock()
+
+	return entry.limiter.AllowN(now, 1)
+}
+
+// sweep drops the idle entries, a dropped client starts over with a full bucket,
+// which an idle client would have refilled by now anyway. Called with mu held.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastSeen) >= l.cfg.IdleTimeout {
+			delete(l.entries, key)
+		}
+	}
+	l.lastSweep = now
+	rateLimiterEntries.Set(float64(len(l.entries)))
+}
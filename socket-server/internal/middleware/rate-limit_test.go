@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/validation"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testLimiter(burst int, idle time.Duration) *RateLimiter {
+	return NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		// no refill within a test
+		Default:     config.RateLimit{PerSecond: 0.001, Burst: burst},
+		IdleTimeout: idle,
+	})
+}
+
+// limited serves route through both buckets, the way main wires them around IdentifyUser.
+func limited(l *RateLimiter, route string, reached *int) http.Handler {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { *reached++ })
+	return Chain(h, l.ByIP(route), l.ByUser(route))
+}
+
+func request(ip string, userId string) *http.Request {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.RemoteAddr = ip + ":5000"
+	if userId != "" {
+		claims := &validation.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: userId}}
+		r = withIdentity(r, "token-of-"+userId, claims)
+	}
+	return r
+}
+
+func serve(h http.Handler, r *http.Request) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec.Code
+}
+
+func TestRateLimiterRefusesPastTheBurst(t *testing.T) {
+	reached := 0
+	h := limited(testLimiter(2, time.Hour), "/ws", &reached)
+
+	for range 2 {
+		if code := serve(h, request("203.0.113.7", "")); code != http.StatusOK {
+			t.Fatalf("request within the burst: %d", code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, request("203.0.113.7", ""))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("request past the burst: %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if reached != 2 {
+		t.Fatalf("handler reached %d times, want 2", reached)
+	}
+	// other ips and routes have their own buckets
+	if code := serve(h, request("203.0.113.8", "")); code != http.StatusOK {
+		t.Errorf("another ip: %d", code)
+	}
+}
+
+func TestRateLimiterSharesTheUserBucketAcrossIPs(t *testing.T) {
+	reached := 0
+	h := limited(testLimiter(2, time.Hour), "/ws", &reached)
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		if code := serve(h, request(ip, "user-1")); code != http.StatusOK {
+			t.Fatalf("request from %s within the user burst: %d", ip, code)
+		}
+	}
+	if code := serve(h, request("203.0.113.3", "user-1")); code != http.StatusTooManyRequests {
+		t.Fatalf("third ip of the same user: %d, want 429", code)
+	}
+	// the ip itself still has room for anonymous requests and other users
+	if code := serve(h, request("203.0.113.3", "")); code != http.StatusOK {
+		t.Errorf("anonymous request from the same ip: %d", code)
+	}
+	if code := serve(h, request("203.0.113.3", "user-2")); code == http.StatusOK {
+		t.Errorf("ip past its burst let another user through")
+	}
+}
+
+func TestRateLimiterDropsIdleEntries(t *testing.T) {
+	l := testLimiter(1, 20*time.Millisecond)
+	reached := 0
+	h := limited(l, "/ws", &reached)
+
+	serve(h, request("203.0.113.7", "user-1"))
+	if code := serve(h, request("203.0.113.7", "user-1")); code != http.StatusTooManyRequests {
+		t.Fatalf("second request: %d, want 429", code)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// the sweep runs on the next request, the idle buckets start over full
+	if code := serve(h, request("203.0.113.8", "")); code != http.StatusOK {
+		t.Fatalf("request after the idle timeout: %d", code)
+	}
+	l.mu.Lock()
+	entries := len(l.entries)
+	l.mu.Unlock()
+	if entries != 1 {
+		t.Fatalf("%d entries after the sweep, want only the new one", entries)
+	}
+	if code := serve(h, request("203.0.113.7", "user-1")); code != http.StatusOK {
+		t.Errorf("client whose buckets were dropped: %d", code)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l := NewRateLimiter(config.RateLimitConfig{Enabled: false})
+	reached := 0
+	h := limited(l, "/ws", &reached)
+	for range 10 {
+		serve(h, request("203.0.113.7", "user-1"))
+	}
+	if reached != 10 {
+		t.Errorf("handler reached %d times, want every request", reached)
+	}
+}
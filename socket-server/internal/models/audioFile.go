@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AudioFile struct {
+	ID                  uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID              uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	Name                string    `gorm:"type:text;not null" json:"name"`
+	Path                string    `gorm:"type:text;not null" json:"path"`
+	Duration            int       `gorm:"type:integer" json:"duration"`
+	FileSize            int64     `gorm:"type:bigint" json:"file_size"`
+	MimeType            *string   `gorm:"type:text" json:"mime_type"`
+	TranscriptionStatus string    `gorm:"type:text" json:"transcription_status"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;autoUpdateTime" json:"updated_at"`
+}
+
+func (AudioFile) TableName() string {
+	return "audio_files"
+}
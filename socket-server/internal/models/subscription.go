@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Subscription struct {
+	ID                   uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID               uuid.UUID  `gorm:"type:uuid;not null;unique" json:"user_id"`
+	StripeCustomerID     string     `gorm:"type:text;not null" json:"stripe_customer_id"`
+	StripeSubscriptionID string     `gorm:"type:text;not null" json:"stripe_subscription_id"`
+	Status               string     `gorm:"type:text;not null" json:"status"`
+	PriceID              string     `gorm:"type:text;not null" json:"price_id"`
+	CurrentPeriodEnd     *time.Time `gorm:"type:timestamptz" json:"current_period_end"`
+	CancelAtPeriodEnd    bool       `gorm:"not null" json:"cancel_at_period_end"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;autoUpdateTime" json:"updated_at"`
+}
+
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Transcript struct {
+	ID               uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AudioID          uuid.UUID `gorm:"type:uuid;not null" json:"audio_id"`
+	Text             string    `gorm:"type:text;not null" json:"text"`
+	Language         string    `gorm:"type:text" json:"language"`
+	ConfidenceScore  *float64  `gorm:"type:numeric(3,2)" json:"confidence_score"`
+	SpeakersDetected int       `gorm:"type:integer" json:"speakers_detected"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;autoCreateTime" json:"created_at"`
+}
+
+func (Transcript) TableName() string {
+	return "transcripts"
+}
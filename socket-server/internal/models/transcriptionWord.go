@@ -0,0 +1,21 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Start and end times are in milliseconds, as AssemblyAI returns them.
+type TranscriptionWord struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TranscriptID uuid.UUID `gorm:"type:uuid;not null" json:"transcript_id"`
+	Text         string    `gorm:"type:text;not null" json:"text"`
+	Confidence   float64   `gorm:"type:double precision;not null" json:"confidence"`
+	StartTime    float64   `gorm:"type:double precision;not null" json:"start_time"`
+	EndTime      float64   `gorm:"type:double precision;not null" json:"end_time"`
+	WordIsFinal  bool      `gorm:"not null" json:"word_is_final"`
+	Speaker      *string   `gorm:"type:text" json:"speaker"`
+}
+
+func (TranscriptionWord) TableName() string {
+	return "transcription_words"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageRecord is one live session in the usage ledger.
+type UsageRecord struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;unique" json:"session_id"`
+	// nil when the session wasn't saved as an audio file
+	AudioID      *uuid.UUID `gorm:"type:uuid" json:"audio_id"`
+	PeriodStart  time.Time  `gorm:"type:timestamptz;not null" json:"period_start"`
+	AudioSeconds int        `gorm:"type:integer;not null" json:"audio_seconds"`
+
+	CreatedAt time.Time `gorm:"type:timestamptz;autoCreateTime" json:"created_at"`
+}
+
+func (UsageRecord) TableName() string {
+	return "usage_ledger"
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"meetingmind-socket/internal/database"
+	"meetingmind-socket/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PLAN_KEY string
+
+const (
+	PLAN_FREE PLAN_KEY = "FREE"
+	PLAN_PRO  PLAN_KEY = "PRO"
+)
+
+type SUBSCRIPTION_STATUS string
+
+const (
+	SUBSCRIPTION_ACTIVE   SUBSCRIPTION_STATUS = "active"
+	SUBSCRIPTION_TRIALING SUBSCRIPTION_STATUS = "trialing"
+	SUBSCRIPTION_PAST_DUE SUBSCRIPTION_STATUS = "past_due"
+	SUBSCRIPTION_CANCELED SUBSCRIPTION_STATUS = "canceled"
+)
+
+// Plan is what a user may do live. The numbers follow PLAN_LIMITS in the web app.
+type Plan struct {
+	Key                   PLAN_KEY
+	MaxSessionLength      time.Duration
+	MaxConcurrentSessions int
+	// live translation is a Pro feature, free users keep the translation tools of the web app
+	Translation    bool
+	MonthlySeconds int64
+}
+
+var Plans = map[PLAN_KEY]Plan{
+	PLAN_FREE: {
+		Key:                   PLAN_FREE,
+		MaxSessionLength:      30 * time.Minute,
+		MaxConcurrentSessions: 1,
+		Translation:           false,
+		MonthlySeconds:        3 * 60 * 60,
+	},
+	PLAN_PRO: {
+		Key:                   PLAN_PRO,
+		MaxSessionLength:      2 * time.Hour,
+		MaxConcurrentSessions: 3,
+		Translation:           true,
+		MonthlySeconds:        50 * 60 * 60,
+	},
+}
+
+// Entitlement is the plan a user gets right now and how much of it is used.
+type Entitlement struct {
+	Plan Plan
+	// Status of the subscription, empty without one
+	Status SUBSCRIPTION_STATUS
+	// Downgraded is set when a past due or canceled subscription fell back to the free plan
+	Downgraded bool
+	// PeriodStart is the start of the month UsedSeconds is counted in
+	PeriodStart time.Time
+	UsedSeconds int64
+}
+
+func (e Entitlement) RemainingSeconds() int64 {
+	return max(e.Plan.MonthlySeconds-e.UsedSeconds, 0)
+}
+
+// PlanForStatus maps a subscription status to a plan, like getUserPlan in the web app:
+// active and trialing subscriptions are Pro, everything else is Free.
+func PlanForStatus(status SUBSCRIPTION_STATUS) (Plan, bool) {
+	switch status {
+	case SUBSCRIPTION_ACTIVE, SUBSCRIPTION_TRIALING:
+		return Plans[PLAN_PRO], false
+	case SUBSCRIPTION_PAST_DUE, SUBSCRIPTION_CANCELED:
+		return Plans[PLAN_FREE], true
+	}
+	return Plans[PLAN_FREE], false
+}
+
+// GetEntitlement looks up the subscription of the user and the seconds they transcribed this month.
+func GetEntitlement(ctx context.Context, userId string, now time.Time) (Entitlement, error) {
+	if database.DB == nil {
+		return Entitlement{}, errors.New("database is not initialized")
+	}
+
+	var subscription models.Subscription
+	status := SUBSCRIPTION_STATUS("")
+	err := database.DB.WithContext(ctx).Where("user_id = ?", userId).First(&subscription).Error
+	if err == nil {
+		status = SUBSCRIPTION_STATUS(subscription.Status)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entitlement{}, fmt.Errorf("failed to load subscription: %w", err)
+	}
+
+	plan, downgraded := PlanForStatus(status)
+	periodStart := UsagePeriodStart(now)
+	used, err := GetPeriodUsageSeconds(ctx, userId, periodStart)
+	if err != nil {
+		return Entitlement{}, err
+	}
+	return Entitlement{
+		Plan:        plan,
+		Status:      status,
+		Downgraded:  downgraded,
+		PeriodStart: periodStart,
+		UsedSeconds: used,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"meetingmind-socket/internal/database"
+	"meetingmind-socket/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const wordsInsertBatchSize = 500
+
+type LiveSession struct {
+	UserId          string
+	Name            string
+	Path            string
+	DurationSeconds int
+	FileSize        int64
+	MimeType        string
+	Text            string
+	Language        string
+	Confidence      *float64
+	Speakers        int
+	Words           []models.TranscriptionWord
+}
+
+// SaveLiveSession stores a finished live session as an audio file, its transcript
+// and every final word, all in one transaction.
+func SaveLiveSession(ctx context.Context, session LiveSession) (models.AudioFile, error) {
+	if database.DB == nil {
+		return models.AudioFile{}, errors.New("database is not initialized")
+	}
+
+	userId, err := uuid.Parse(session.UserId)
+	if err != nil {
+		return models.AudioFile{}, fmt.Errorf("invalid user id %q: %w", session.UserId, err)
+	}
+
+	audio := models.AudioFile{
+		UserID:              userId,
+		Name:                session.Name,
+		Path:                session.Path,
+		Duration:            session.DurationSeconds,
+		FileSize:            session.FileSize,
+		TranscriptionStatus: "done",
+	}
+	if session.MimeType != "" {
+		audio.MimeType = &session.MimeType
+	}
+
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&audio).Error; err != nil {
+			return fmt.Errorf("failed to insert audio file: %w", err)
+		}
+
+		transcript := models.Transcript{
+			AudioID:          audio.ID,
+			Text:             session.Text,
+			Language:         session.Language,
+			ConfidenceScore:  session.Confidence,
+			SpeakersDetected: max(session.Speakers, 1),
+		}
+		if err := tx.Create(&transcript).Error; err != nil {
+			return fmt.Errorf("failed to insert transcript: %w", err)
+		}
+
+		if len(session.Words) == 0 {
+			return nil
+		}
+		for i := range session.Words {
+			session.Words[i].TranscriptID = transcript.ID
+		}
+		if err := tx.CreateInBatches(session.Words, wordsInsertBatchSize).Error; err != nil {
+			return fmt.Errorf("failed to insert transcription words: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.AudioFile{}, err
+	}
+	return audio, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"meetingmind-socket/internal/database"
+	"meetingmind-socket/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// UsagePeriodStart is the start of the period usage is counted in, the calendar month (UTC)
+// like getCurrentMonthRange in the web app.
+func UsagePeriodStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetPeriodUsageSeconds sums what the user transcribed in the period starting at periodStart, the
+// same rows as getMonthlyUsageSeconds in the web app: the durations of their audio files, uploads
+// and saved live sessions, plus the ledger of live sessions that weren't saved as an audio file.
+func GetPeriodUsageSeconds(ctx context.Context, userId string, periodStart time.Time) (int64, error) {
+	var files int64
+	err := database.DB.WithContext(ctx).Model(&models.AudioFile{}).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userId, periodStart, periodStart.AddDate(0, 1, 0)).
+		Select("COALESCE(SUM(duration), 0)").
+		Scan(&files).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum audio file durations: %w", err)
+	}
+
+	var live int64
+	err = database.DB.WithContext(ctx).Model(&models.UsageRecord{}).
+		Where("user_id = ? AND period_start = ? AND audio_id IS NULL", userId, periodStart).
+		Select("COALESCE(SUM(audio_seconds), 0)").
+		Scan(&live).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum period usage: %w", err)
+	}
+	return files + live, nil
+}
+
+// RecordUsage adds a finished session to the ledger, recording the same session twice is a no-op.
+// audioId is the audio file the session was saved as, empty when it wasn't saved.
+func RecordUsage(ctx context.Context, userId, sessionId, audioId string, periodStart time.Time, audioSeconds int) error {
+	if database.DB == nil {
+		return errors.New("database is not initialized")
+	}
+
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		return fmt.Errorf("invalid user id %q: %w", userId, err)
+	}
+	sessionUUID, err := uuid.Parse(sessionId)
+	if err != nil {
+		return fmt.Errorf("invalid session id %q: %w", sessionId, err)
+	}
+
+	var audioUUID *uuid.UUID
+	if audioId != "" {
+		parsed, err := uuid.Parse(audioId)
+		if err != nil {
+			return fmt.Errorf("invalid audio id %q: %w", audioId, err)
+		}
+		audioUUID = &parsed
+	}
+
+	record := models.UsageRecord{
+		UserID:       userUUID,
+		AudioID:      audioUUID,
+		SessionID:    sessionUUID,
+		PeriodStart:  periodStart,
+		AudioSeconds: audioSeconds,
+	}
+	err = database.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "session_id"}}, DoNothing: true}).
+		Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type LocalStorage struct {
+	Root string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir: %w", err)
+	}
+	return &LocalStorage{Root: root}, nil
+}
+
+func (l *LocalStorage) Save(ctx context.Context, path string, body io.Reader, contentType string) (int64, error) {
+	fullPath, err := l.resolve(path)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	// write next to the target and rename, so a half written file never shows up
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return 0, fmt.Errorf("failed to move file in place: %w", err)
+	}
+	return size, nil
+}
+
+func (l *LocalStorage) resolve(path string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("invalid storage path: " + path)
+	}
+	return filepath.Join(l.Root, clean), nil
+}
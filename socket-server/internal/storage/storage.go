@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Storage keeps session recordings. Paths are relative and use forward slashes,
+// e.g. recordings/<user id>/<session id>.wav.
+type Storage interface {
+	Save(ctx context.Context, path string, body io.Reader, contentType string) (int64, error)
+}
+
+// New builds the storage of the given kind, nil when kind is empty and recording is off.
+func New(kind string, dir string) (Storage, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "local":
+		return NewLocalStorage(dir)
+	default:
+		return nil, fmt.Errorf("unknown recording storage: %s", kind)
+	}
+}
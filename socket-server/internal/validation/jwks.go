@@ -0,0 +1,201 @@
+package validation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// a token naming an unknown kid refetches the keys, but not more often than this
+const minJwksRefetch = 30 * time.Second
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// keySet caches the public keys of a JWKS by kid. Keys are reloaded every ttl and when
+// a token names a kid the set doesn't know, which is how rotated keys show up.
+// When a reload fails the keys already loaded keep working.
+type keySet struct {
+	url  string
+	file string
+	ttl  time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	lastAttempt time.Time
+	// closed once the reload in progress finished, nil while none runs
+	loading chan struct{}
+}
+
+func newKeySet(url, file string, ttl time.Duration) *keySet {
+	return &keySet{url: url, file: file, ttl: ttl, keys: make(map[string]crypto.PublicKey)}
+}
+
+func (s *keySet) get(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	stale := time.Since(s.loadedAt) >= s.ttl
+	var loading chan struct{}
+	if (stale || !ok) && (s.loading != nil || time.Since(s.lastAttempt) >= minJwksRefetch) {
+		loading = s.reloadLocked()
+	}
+	s.mu.Unlock()
+
+	// a known key keeps working while the set reloads, an unknown one waits for the reload
+	if !ok && loading != nil {
+		<-loading
+		s.mu.Lock()
+		key, ok = s.keys[kid]
+		s.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// reloadLocked starts a reload unless one is in progress and returns the channel closed when it is done.
+func (s *keySet) reloadLocked() chan struct{} {
+	if s.loading == nil {
+		done := make(chan struct{})
+		s.loading = done
+		go func() {
+			if err := s.load(); err != nil {
+				s.logLoadError(err)
+			}
+			s.mu.Lock()
+			s.loading = nil
+			s.mu.Unlock()
+			close(done)
+		}()
+	}
+	return s.loading
+}
+
+// load fetches the keys without holding mu, tokens with known keys never wait for the fetch.
+func (s *keySet) load() error {
+	s.mu.Lock()
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *keySet) logLoadError(err error) {
+	slog.Warn("failed to load jwks, keeping the keys already loaded", "url", s.url, "file", s.file, "err", err)
+}
+
+func (s *keySet) read() ([]byte, error) {
+	if s.file != "" {
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwks file: %w", err)
+		}
+		return data, nil
+	}
+
+	resp, err := jwksClient.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS reads the RSA and P-256 signing keys of a JWKS document, other keys are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch {
+		case k.Kty == "RSA":
+			key, err = rsaKey(k)
+		case k.Kty == "EC" && k.Crv == "P-256":
+			key, err = ecKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable signing key")
+	}
+	return keys, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+		return nil, errors.New("invalid P-256 coordinates")
+	}
+	// uncompressed point: 0x04 || x || y
+	point := append(append([]byte{4}, x...), y...)
+	return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+}
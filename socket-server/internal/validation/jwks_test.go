@@ -0,0 +1,242 @@
+package validation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// toJWK writes a public key the way Supabase publishes it.
+func toJWK(t *testing.T, kid string, key crypto.PublicKey) jwk {
+	t.Helper()
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", Kid: kid, Use: "sig", N: b64.EncodeToString(key.N.Bytes()), E: b64.EncodeToString(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		point, err := key.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// uncompressed point: 0x04 || x || y
+		return jwk{Kty: "EC", Kid: kid, Use: "sig", Crv: "P-256", X: b64.EncodeToString(point[1:33]), Y: b64.EncodeToString(point[33:])}
+	}
+	t.Fatalf("unsupported key %T", key)
+	return jwk{}
+}
+
+func jwksDoc(t *testing.T, keys ...jwk) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// jwksServer serves whatever doc holds and counts the fetches, a nil doc answers 500.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu  sync.Mutex
+	doc []byte
+}
+
+func startJwksServer(t *testing.T, doc []byte) *jwksServer {
+	t.Helper()
+	s := &jwksServer{doc: doc}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		doc := s.doc
+		s.mu.Unlock()
+		if doc == nil {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		// long enough for concurrent gets to pile up on one fetch
+		time.Sleep(20 * time.Millisecond)
+		w.Write(doc)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) serve(doc []byte) {
+	s.mu.Lock()
+	s.doc = doc
+	s.mu.Unlock()
+}
+
+// allowRefetch moves the last fetch back past minJwksRefetch, and with stale past the ttl too.
+func allowRefetch(s *keySet, stale bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastAttempt = time.Now().Add(-minJwksRefetch)
+	if stale {
+		s.loadedAt = time.Now().Add(-s.ttl)
+	}
+}
+
+func TestKeySetPicksUpRotatedKeys(t *testing.T) {
+	first, second := toJWK(t, "first", &newECKey(t).PublicKey), toJWK(t, "second", &newECKey(t).PublicKey)
+	srv := startJwksServer(t, jwksDoc(t, first))
+	keys := newKeySet(srv.URL, "", time.Hour)
+	if err := keys.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.serve(jwksDoc(t, first, second))
+	// fetched moments ago, an unknown kid doesn't refetch yet
+	if _, err := keys.get("second"); err == nil {
+		t.Fatal("rotated key known before the keys were fetched again")
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Fatalf("%d fetches within minJwksRefetch, want 1", n)
+	}
+
+	allowRefetch(keys, false)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Go(func() {
+			_, err := keys.get("second")
+			errs <- err
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("rotated key not picked up: %v", err)
+		}
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Fatalf("%d fetches for the rotated key, want one more", n)
+	}
+
+	if _, err := keys.get("never-published"); err == nil {
+		t.Fatal("unknown kid accepted")
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Fatalf("%d fetches, an unknown kid right after a fetch refetched", n)
+	}
+}
+
+func TestKeySetKeepsKeysWhenReloadFails(t *testing.T) {
+	srv := startJwksServer(t, jwksDoc(t, toJWK(t, "kept", &newRSAKey(t).PublicKey)))
+	keys := newKeySet(srv.URL, "", time.Minute)
+	if err := keys.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.serve(nil)
+	allowRefetch(keys, true)
+	if _, err := keys.get("unknown"); err == nil {
+		t.Fatal("unknown kid accepted")
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Fatalf("%d fetches, want the failed reload to be tried", n)
+	}
+	if _, err := keys.get("kept"); err != nil {
+		t.Fatalf("key loaded before the failed reload: %v", err)
+	}
+
+	srv.serve(jwksDoc(t, jwk{Kty: "oct", Kid: "useless"}))
+	allowRefetch(keys, true)
+	if _, err := keys.get("useless"); err == nil {
+		t.Fatal("key of an unusable jwks accepted")
+	}
+	if _, err := keys.get("kept"); err != nil {
+		t.Fatalf("key loaded before the invalid jwks: %v", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaJWK := toJWK(t, "rsa", &newRSAKey(t).PublicKey)
+	ecJWK := toJWK(t, "ec", &newECKey(t).PublicKey)
+	with := func(k jwk, change func(k *jwk)) jwk {
+		change(&k)
+		return k
+	}
+
+	tests := []struct {
+		name     string
+		doc      []byte
+		wantKids []string
+		wantErr  string
+	}{
+		{name: "rsa and ec keys", doc: jwksDoc(t, rsaJWK, ecJWK), wantKids: []string{"ec", "rsa"}},
+		{
+			name: "other keys are skipped",
+			doc: jwksDoc(t, rsaJWK,
+				jwk{Kty: "oct", Kid: "hmac"},
+				with(ecJWK, func(k *jwk) { k.Kid = "p384"; k.Crv = "P-384" }),
+				with(ecJWK, func(k *jwk) { k.Kid = "encryption"; k.Use = "enc" }),
+				with(ecJWK, func(k *jwk) { k.Kid = "" }),
+			),
+			wantKids: []string{"rsa"},
+		},
+		{name: "not json", doc: []byte("<html>"), wantErr: "invalid jwks"},
+		{name: "no usable key", doc: jwksDoc(t, jwk{Kty: "oct", Kid: "hmac"}), wantErr: "no usable signing key"},
+		{name: "rsa without modulus", doc: jwksDoc(t, with(rsaJWK, func(k *jwk) { k.N = "" })), wantErr: "invalid modulus"},
+		{name: "rsa modulus not base64url", doc: jwksDoc(t, with(rsaJWK, func(k *jwk) { k.N = "not+base64/" })), wantErr: "invalid modulus"},
+		{name: "rsa exponent too long", doc: jwksDoc(t, with(rsaJWK, func(k *jwk) { k.E = b64.EncodeToString([]byte{1, 0, 0, 0, 1}) })), wantErr: "invalid exponent"},
+		{name: "ec coordinate too short", doc: jwksDoc(t, with(ecJWK, func(k *jwk) { k.X = b64.EncodeToString(make([]byte, 31)) })), wantErr: "invalid P-256 coordinates"},
+		{name: "ec point off the curve", doc: jwksDoc(t, with(ecJWK, func(k *jwk) { k.Y = k.X })), wantErr: `jwks key "ec"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseJWKS(tt.doc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != len(tt.wantKids) {
+				t.Fatalf("got %d keys, want %v", len(keys), tt.wantKids)
+			}
+			for _, kid := range tt.wantKids {
+				if keys[kid] == nil {
+					t.Errorf("key %q missing", kid)
+				}
+			}
+		})
+	}
+}
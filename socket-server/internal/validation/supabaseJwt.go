@@ -2,35 +2,103 @@ package validation
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"meetingmind-socket/internal/config"
+	"slices"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func ValidateSupabaseJWT(tokenString string, secret string) (string, error) {
+// Claims are the parts of a Supabase access token the server uses.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role        string `json:"role"`
+	Email       string `json:"email"`
+	SessionID   string `json:"session_id"`
+	IsAnonymous bool   `json:"is_anonymous"`
+}
+
+// UserID is the Supabase user id, the sub claim.
+func (c *Claims) UserID() string {
+	return c.Subject
+}
 
-    token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-        if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, errors.New("unexpected signing method")
-        }
-        return []byte(secret), nil
-    })
+// Verifier checks Supabase access tokens: legacy HS256 ones with the shared secret,
+// RS256 and ES256 ones with the JWKS key their kid names.
+type Verifier struct {
+	secret []byte
+	keys   *keySet
+	roles  []string
+	parser *jwt.Parser
+}
 
-    if err != nil || !token.Valid {
-        log.Println("Error when validate jwt key: ", err)
-        return "", errors.New("invalid jwt")
-    }
+// NewVerifier loads the JWKS, a file that can't be read is an error,
+// a url that can't be fetched yet is retried on the first token.
+func NewVerifier(secret string, cfg config.AuthConfig) (*Verifier, error) {
+	v := &Verifier{roles: cfg.Roles}
 
-    claims, ok := token.Claims.(jwt.MapClaims)
-    if !ok {
-        return "", errors.New("invalid claims")
-    }
+	var methods []string
+	if secret != "" {
+		v.secret = []byte(secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JwksURL != "" || cfg.JwksFile != "" {
+		v.keys = newKeySet(cfg.JwksURL, cfg.JwksFile, cfg.JwksCacheTTL)
+		if err := v.keys.load(); err != nil {
+			if cfg.JwksFile != "" {
+				return nil, err
+			}
+			v.keys.logLoadError(err)
+		}
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no jwt secret or jwks to verify tokens with")
+	}
 
-    supabaseUserId, ok := claims["sub"].(string)
-    if !ok {
-        return "", errors.New("no sub in token")
-    }
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	v.parser = jwt.NewParser(options...)
+	return v, nil
+}
 
-    return supabaseUserId, nil
+// Verify checks the signature, exp, aud, iss and role of the token and returns its claims.
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFor)
+	if err != nil {
+		// callers log the reason, it is never sent back to the browser
+		return nil, errors.Join(errors.New("invalid jwt"), err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("no sub in token")
+	}
+	if len(v.roles) > 0 && !slices.Contains(v.roles, claims.Role) {
+		return nil, fmt.Errorf("role %q is not allowed", claims.Role)
+	}
+	return claims, nil
 }
 
+func (v *Verifier) keyFor(t *jwt.Token) (any, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return v.secret, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("no kid in token header")
+		}
+		return v.keys.get(kid)
+	}
+	return nil, errors.New("unexpected signing method")
+}
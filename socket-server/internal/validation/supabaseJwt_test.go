@@ -0,0 +1,189 @@
+package validation
+
+import (
+	"crypto/x509"
+	"meetingmind-socket/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":  "user-1",
+		"aud":  "authenticated",
+		"iss":  "https://project.supabase.co/auth/v1",
+		"role": "authenticated",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// writeJwks puts the doc in a file for a file-backed key set.
+func writeJwks(t *testing.T, doc []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, doc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, ecKey := newRSAKey(t), newECKey(t)
+	otherRSAKey := newRSAKey(t)
+	jwksFile := writeJwks(t, jwksDoc(t, toJWK(t, "rsa", &rsaKey.PublicKey), toJWK(t, "ec", &ecKey.PublicKey)))
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(change func(c jwt.MapClaims)) jwt.MapClaims {
+		claims := validClaims()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name string
+		// no secret: only the JWKS verifies tokens
+		jwksOnly bool
+		token    string
+		wantErr  bool
+	}{
+		{name: "HS256 with the secret", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims())},
+		{name: "RS256 with a jwks key", token: sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", validClaims())},
+		{name: "ES256 with a jwks key", token: sign(t, jwt.SigningMethodES256, ecKey, "ec", validClaims())},
+		{name: "RS256 with only a jwks", jwksOnly: true, token: sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", validClaims())},
+		{
+			name:     "HS256 when only a jwks is configured",
+			jwksOnly: true,
+			token:    sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims()),
+			wantErr:  true,
+		},
+		{
+			name:     "HS256 signed with the public key",
+			jwksOnly: true,
+			token:    sign(t, jwt.SigningMethodHS256, publicDER, "rsa", validClaims()),
+			wantErr:  true,
+		},
+		{name: "HS256 with a wrong secret", token: sign(t, jwt.SigningMethodHS256, []byte("guess"), "", validClaims()), wantErr: true},
+		{name: "none algorithm", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims()), wantErr: true},
+		{name: "RS256 signed by another key", token: sign(t, jwt.SigningMethodRS256, otherRSAKey, "rsa", validClaims()), wantErr: true},
+		{name: "ES256 naming the rsa kid", token: sign(t, jwt.SigningMethodES256, ecKey, "rsa", validClaims()), wantErr: true},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, rsaKey, "rotated-away", validClaims()), wantErr: true},
+		{name: "no kid", token: sign(t, jwt.SigningMethodRS256, rsaKey, "", validClaims()), wantErr: true},
+		{
+			name:    "wrong audience",
+			token:   sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", with(func(c jwt.MapClaims) { c["aud"] = "other-project" })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", with(func(c jwt.MapClaims) { c["iss"] = "https://evil.example/auth/v1" })),
+			wantErr: true,
+		},
+		{
+			name:    "disallowed role",
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with(func(c jwt.MapClaims) { c["role"] = "anon" })),
+			wantErr: true,
+		},
+		{
+			name:    "missing exp",
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with(func(c jwt.MapClaims) { delete(c, "exp") })),
+			wantErr: true,
+		},
+		{
+			name:    "expired past the leeway",
+			token:   sign(t, jwt.SigningMethodES256, ecKey, "ec", with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })),
+			wantErr: true,
+		},
+		{
+			name:  "expired within the leeway",
+			token: sign(t, jwt.SigningMethodES256, ecKey, "ec", with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-10 * time.Second).Unix() })),
+		},
+		{
+			name:    "missing sub",
+			token:   sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", with(func(c jwt.MapClaims) { delete(c, "sub") })),
+			wantErr: true,
+		},
+	}
+
+	auth := config.Default().Auth
+	auth.JwksFile = jwksFile
+	auth.Issuer = "https://project.supabase.co/auth/v1"
+	verifier, err := NewVerifier(testSecret, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksOnly, err := NewVerifier("", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := verifier
+			if tt.jwksOnly {
+				v = jwksOnly
+			}
+			claims, err := v.Verify(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("token accepted, claims %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID() != "user-1" || claims.Role != "authenticated" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	if _, err := NewVerifier("", config.Default().Auth); err == nil {
+		t.Error("verifier without a secret or jwks created")
+	}
+
+	auth := config.Default().Auth
+	auth.JwksFile = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := NewVerifier("", auth); err == nil {
+		t.Error("verifier created with a jwks file that can't be read")
+	}
+
+	// a jwks url that can't be fetched yet is retried on the first token
+	srv := startJwksServer(t, nil)
+	auth = config.Default().Auth
+	auth.JwksURL = srv.URL
+	v, err := NewVerifier("", auth)
+	if err != nil {
+		t.Fatalf("verifier with an unreachable jwks url: %v", err)
+	}
+	key := newECKey(t)
+	srv.serve(jwksDoc(t, toJWK(t, "late", &key.PublicKey)))
+	allowRefetch(v.keys, false)
+	if _, err := v.Verify(sign(t, jwt.SigningMethodES256, key, "late", validClaims())); err != nil {
+		t.Errorf("token with a key published after startup: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"meetingmind-socket/internal/middleware"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TERMINATED_RESPONSE RESPONSE_TYPE = "terminated"
+
+const (
+	defaultAdminTranscriptTurns = 20
+	maxAdminTranscriptTurns     = 500
+)
+
+// SessionInfo is what the admin API shows about one live session.
+type SessionInfo struct {
+	SessionId      string         `json:"sessionId"`
+	UserId         string         `json:"userId"`
+	StartedAt      time.Time      `json:"startedAt"`
+	ExpiresAt      time.Time      `json:"expiresAt"`
+	TokenExpiresAt time.Time      `json:"tokenExpiresAt"`
+	Plan           string         `json:"plan"`
+	BytesStreamed  int64          `json:"bytesStreamed"`
+	AudioSeconds   int            `json:"audioSeconds"`
+	Paused         bool           `json:"paused"`
+	Detached       bool           `json:"detached"`
+	Upstream       UPSTREAM_STATE `json:"upstream"`
+	Language       string         `json:"language"`
+	TargetLanguage string         `json:"targetLanguage,omitempty"`
+	RoomId         string         `json:"roomId,omitempty"`
+}
+
+type TranscriptTurnInfo struct {
+	TurnOrder   int    `json:"turnOrder"`
+	Speaker     string `json:"speaker,omitempty"`
+	SpeakerName string `json:"speakerName,omitempty"`
+	Text        string `json:"text"`
+}
+
+func (c *Client) Info() SessionInfo {
+	info := SessionInfo{
+		SessionId:      c.SessionId,
+		UserId:         c.UserId,
+		StartedAt:      c.StartTime,
+		ExpiresAt:      c.ExpiresAt,
+		TokenExpiresAt: c.TokenExpiresAt(),
+		Plan:           string(c.Entitlement.Plan.Key),
+		BytesStreamed:  c.audioBytes.Load(),
+		AudioSeconds:   c.meteredSeconds(),
+		Paused:         c.paused.Load(),
+		Detached:       c.isDetached(),
+		Upstream:       c.UpstreamState(),
+		Language:       c.Language(),
+		TargetLanguage: c.TargetLanguage(),
+	}
+	if c.room != nil {
+		info.RoomId = c.room.Id
+	}
+	return info
+}
+
+// recentTranscript is the last limit turns with final words, oldest first.
+func (c *Client) recentTranscript(limit int) []TranscriptTurnInfo {
+	turns := c.Transcript.FinishedTurns()
+	if len(turns) > limit {
+		turns = turns[len(turns)-limit:]
+	}
+	out := make([]TranscriptTurnInfo, 0, len(turns))
+	for _, turn := range turns {
+		text := turn.Transcript
+		if text == "" {
+			text = joinWords(turn.Words)
+		}
+		out = append(out, TranscriptTurnInfo{
+			TurnOrder:   turn.TurnOrder,
+			Speaker:     turn.Speaker,
+			SpeakerName: c.Transcript.SpeakerName(turn.Speaker),
+			Text:        text,
+		})
+	}
+	return out
+}
+
+// Terminate ends the session now, the browser is told why. What was transcribed so far is saved.
+func (c *Client) Terminate(reason string) {
+	c.Logger.Info("session terminated", "reason", reason)
+	c.send(NewStatusWriter(TERMINATED_RESPONSE, reason))
+	c.Close(fmt.Errorf("%w: %s", ErrTerminated, reason))
+}
+
+// AdminListSessions serves GET /admin/sessions, ?user_id= narrows it to one user.
+func (s *Server) AdminListSessions(w http.ResponseWriter, r *http.Request) {
+	clients := allSessions()
+	if userId := r.URL.Query().Get("user_id"); userId != "" {
+		clients = slices.DeleteFunc(clients, func(c *Client) bool { return c.UserId != userId })
+	}
+	slices.SortFunc(clients, func(a, b *Client) int { return a.StartTime.Compare(b.StartTime) })
+
+	infos := make([]SessionInfo, 0, len(clients))
+	for _, c := range clients {
+		infos = append(infos, c.Info())
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": infos, "count": len(infos)})
+}
+
+// AdminGetSession serves GET /admin/sessions/{id}.
+func (s *Server) AdminGetSession(w http.ResponseWriter, r *http.Request) {
+	c := FindSession(r.PathValue("id"))
+	if c == nil {
+		writeJSONError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Info())
+}
+
+// AdminSessionTranscript serves GET /admin/sessions/{id}/transcript?limit=20.
+func (s *Server) AdminSessionTranscript(w http.ResponseWriter, r *http.Request) {
+	c := FindSession(r.PathValue("id"))
+	if c == nil {
+		writeJSONError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	limit := defaultAdminTranscriptTurns
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxAdminTranscriptTurns)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessionId": c.SessionId, "turns": c.recentTranscript(limit)})
+}
+
+// AdminTerminateSession serves POST /admin/sessions/{id}/terminate with {"reason": "..."}.
+func (s *Server) AdminTerminateSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body must be {\"reason\": \"...\"}")
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		writeJSONError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+
+	c := FindSession(r.PathValue("id"))
+	if c == nil {
+		writeJSONError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	c.Logger.Info("admin terminating session", "admin_id", middleware.UserID(r))
+	c.Terminate(reason)
+	writeJSON(w, http.StatusOK, c.Info())
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
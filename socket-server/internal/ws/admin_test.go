@@ -0,0 +1,218 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"meetingmind-socket/internal/middleware"
+	"meetingmind-socket/internal/models"
+	"meetingmind-socket/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startAdminServer serves the admin routes the way main.go does, only admin-user may use them.
+func startAdminServer(t *testing.T, tweak func(s *Server)) (wsURL string, adminURL string) {
+	t.Helper()
+	var server *Server
+	wsURL, _ = startTestServer(t, func(s *Server) {
+		server = s
+		tweak(s)
+	})
+
+	admin := func(h http.HandlerFunc) http.Handler {
+		return middleware.Chain(h, middleware.AuthMiddleware(server.Verifier), middleware.RequireUsers([]string{"admin-user"}))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/sessions", admin(server.AdminListSessions))
+	mux.Handle("GET /admin/sessions/{id}", admin(server.AdminGetSession))
+	mux.Handle("GET /admin/sessions/{id}/transcript", admin(server.AdminSessionTranscript))
+	mux.Handle("POST /admin/sessions/{id}/terminate", admin(server.AdminTerminateSession))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return wsURL, srv.URL
+}
+
+// adminRequest calls the admin api as userId and decodes the json answer into out.
+func adminRequest(t *testing.T, userId string, method string, url string, body string, out any) int {
+	t.Helper()
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+testToken(t, userId, time.Hour))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAdminSessions(t *testing.T) {
+	wsURL, adminURL := startAdminServer(t, func(s *Server) {})
+	first := dialSession(t, wsURL)
+	firstId := readUntil(t, first, SESSION_RESPONSE)["sessionId"].(string)
+	// closed before the cleanup of dialSession waits for no session to be left
+	other, _, err := websocket.DefaultDialer.Dial(withToken(wsURL, testToken(t, "other-user", time.Hour)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+	otherId := readUntil(t, other, SESSION_RESPONSE)["sessionId"].(string)
+
+	// every step of the fixture, two finished turns
+	sendFrames(t, first, 15)
+	waitFor(t, "both turns", func() bool { return len(FindSession(firstId).Transcript.FinishedTurns()) == 2 })
+
+	t.Run("list", func(t *testing.T) {
+		var list struct {
+			Sessions []SessionInfo `json:"sessions"`
+			Count    int           `json:"count"`
+		}
+		if code := adminRequest(t, "admin-user", "GET", adminURL+"/admin/sessions", "", &list); code != http.StatusOK {
+			t.Fatalf("status %d", code)
+		}
+		if list.Count != 2 || len(list.Sessions) != 2 || list.Sessions[0].SessionId != firstId || list.Sessions[1].SessionId != otherId {
+			t.Errorf("listed %+v, want both sessions oldest first", list)
+		}
+		if list.Sessions[0].BytesStreamed != 15*3200 || list.Sessions[0].UserId != "test-user" {
+			t.Errorf("first session %+v", list.Sessions[0])
+		}
+
+		list.Sessions = nil
+		adminRequest(t, "admin-user", "GET", adminURL+"/admin/sessions?user_id=other-user", "", &list)
+		if list.Count != 1 || list.Sessions[0].SessionId != otherId {
+			t.Errorf("filtered to %+v, want the session of other-user", list)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		var info SessionInfo
+		if code := adminRequest(t, "admin-user", "GET", adminURL+"/admin/sessions/"+otherId, "", &info); code != http.StatusOK || info.UserId != "other-user" {
+			t.Errorf("got %d %+v", code, info)
+		}
+		if code := adminRequest(t, "admin-user", "GET", adminURL+"/admin/sessions/no-such-session", "", nil); code != http.StatusNotFound {
+			t.Errorf("unknown session: %d, want 404", code)
+		}
+	})
+
+	t.Run("transcript", func(t *testing.T) {
+		tests := []struct {
+			limit     string
+			wantCode  int
+			wantTexts []string
+		}{
+			{limit: "", wantCode: http.StatusOK, wantTexts: []string{"hello world", "this is a test"}},
+			{limit: "?limit=1", wantCode: http.StatusOK, wantTexts: []string{"this is a test"}},
+			{limit: "?limit=100000", wantCode: http.StatusOK, wantTexts: []string{"hello world", "this is a test"}},
+			{limit: "?limit=0", wantCode: http.StatusBadRequest},
+			{limit: "?limit=-3", wantCode: http.StatusBadRequest},
+			{limit: "?limit=ten", wantCode: http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			var body struct {
+				Turns []TranscriptTurnInfo `json:"turns"`
+			}
+			code := adminRequest(t, "admin-user", "GET", adminURL+"/admin/sessions/"+firstId+"/transcript"+tt.limit, "", &body)
+			if code != tt.wantCode {
+				t.Errorf("limit %q: status %d, want %d", tt.limit, code, tt.wantCode)
+				continue
+			}
+			var texts []string
+			for _, turn := range body.Turns {
+				texts = append(texts, turn.Text)
+			}
+			if strings.Join(texts, "|") != strings.Join(tt.wantTexts, "|") {
+				t.Errorf("limit %q: turns %q, want %q", tt.limit, texts, tt.wantTexts)
+			}
+		}
+		if code := adminRequest(t, "admin-user", "GET", adminURL+"/admin/sessions/no-such-session/transcript", "", nil); code != http.StatusNotFound {
+			t.Errorf("unknown session: %d, want 404", code)
+		}
+	})
+}
+
+func TestAdminTerminateSession(t *testing.T) {
+	saved := make(chan service.LiveSession, 1)
+	wsURL, adminURL := startAdminServer(t, func(s *Server) {
+		s.SaveSession = func(ctx context.Context, ls service.LiveSession) (models.AudioFile, error) {
+			saved <- ls
+			return models.AudioFile{}, nil
+		}
+	})
+	conn := dialSession(t, wsURL)
+	sessionId := readUntil(t, conn, SESSION_RESPONSE)["sessionId"].(string)
+	client := FindSession(sessionId)
+	sendFrames(t, conn, 10)
+	waitFor(t, "the first turn", func() bool { return len(client.Transcript.FinishedTurns()) == 1 })
+
+	terminate := adminURL + "/admin/sessions/" + sessionId + "/terminate"
+	for _, body := range []string{"", "{}", `{"reason": "  "}`, "not json"} {
+		if code := adminRequest(t, "admin-user", "POST", terminate, body, nil); code != http.StatusBadRequest {
+			t.Errorf("body %q: status %d, want 400", body, code)
+		}
+	}
+	if code := adminRequest(t, "admin-user", "POST", adminURL+"/admin/sessions/no-such-session/terminate", `{"reason": "abuse"}`, nil); code != http.StatusNotFound {
+		t.Errorf("unknown session: %d, want 404", code)
+	}
+	if n := countSessions(); n != 1 {
+		t.Fatalf("%d sessions after rejected terminations, want 1", n)
+	}
+
+	if code := adminRequest(t, "admin-user", "POST", terminate, `{"reason": "abuse report"}`, nil); code != http.StatusOK {
+		t.Fatalf("terminate: status %d", code)
+	}
+	if msg := readUntil(t, conn, TERMINATED_RESPONSE); msg["message"] != "abuse report" {
+		t.Errorf("browser was told %v, want the reason", msg)
+	}
+	waitFor(t, "session to end", func() bool { return countSessions() == 0 })
+	if cause := client.Cause(); !errors.Is(cause, ErrTerminated) {
+		t.Errorf("session ended with %v, want %v", cause, ErrTerminated)
+	}
+	select {
+	case ls := <-saved:
+		if ls.UserId != "test-user" || !strings.Contains(ls.Text, "hello world") {
+			t.Errorf("saved %+v, want the transcript so far", ls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("terminated session was not saved")
+	}
+}
+
+func TestAdminRoutesNeedAnAdmin(t *testing.T) {
+	_, adminURL := startAdminServer(t, func(s *Server) {})
+	routes := []struct{ method, path string }{
+		{"GET", "/admin/sessions"},
+		{"GET", "/admin/sessions/some-id"},
+		{"GET", "/admin/sessions/some-id/transcript"},
+		{"POST", "/admin/sessions/some-id/terminate"},
+	}
+	for _, route := range routes {
+		if code := adminRequest(t, "test-user", route.method, adminURL+route.path, `{"reason": "x"}`, nil); code != http.StatusForbidden {
+			t.Errorf("%s %s as a regular user: %d, want 403", route.method, route.path, code)
+		}
+		r, err := http.NewRequest(route.method, adminURL+route.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token: %d, want 401", route.method, route.path, resp.StatusCode)
+		}
+	}
+}
@@ -1,69 +1,212 @@
 package ws
 
 import (
-	"net/http"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"meetingmind-socket/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/gorilla/websocket"
-	"log"
-	"fmt"
 )
-var TimeConsume = 60 // 1 min
 
-func ConnectToAssemblyAI( apiKey string) (*websocket.Conn, *http.Response, error) {
-	
-	token, err := getStreamingToken(apiKey, TimeConsume)
+// Streaming models of AssemblyAI, the multilingual one covers SupportedTranscriptLanguages.
+const (
+	SPEECH_MODEL_ENGLISH      = "universal-streaming-english"
+	SPEECH_MODEL_MULTILINGUAL = "universal-streaming-multilingual"
+)
+
+// speechModel is the streaming model that transcribes language.
+func speechModel(language string) string {
+	if language == "en" {
+		return SPEECH_MODEL_ENGLISH
+	}
+	return SPEECH_MODEL_MULTILINGUAL
+}
+
+// assemblyWsURL turns the http(s) base url into the ws(s) streaming endpoint of the model for language.
+func assemblyWsURL(baseURL string, token string, language string) string {
+	wsBase := strings.TrimRight(baseURL, "/")
+	if strings.HasPrefix(wsBase, "https://") {
+		wsBase = "wss://" + strings.TrimPrefix(wsBase, "https://")
+	} else if strings.HasPrefix(wsBase, "http://") {
+		wsBase = "ws://" + strings.TrimPrefix(wsBase, "http://")
+	}
+	return wsBase + "/v3/ws?sample_rate=16000&speaker_labels=true&speech_model=" + speechModel(language) +
+		"&token=" + url.QueryEscape(token)
+}
+
+// ConnectToAssemblyAI mints a single use streaming token and opens the stream of language with it,
+// both within upstream.ConnectTimeout.
+func ConnectToAssemblyAI(ctx context.Context, upstream config.UpstreamConfig, language string) (*websocket.Conn, *http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstream.ConnectTimeout)
+	defer cancel()
+
+	token, err := getStreamingToken(ctx, upstream.BaseURL, upstream.ApiKey, int(upstream.TokenTTL.Seconds()))
 	if err != nil {
-		log.Fatal("err when getStreaming token: ", err)
+		upstreamConnectFailures.With("token").Inc()
+		return nil, nil, fmt.Errorf("failed to get a streaming token: %w", err)
 	}
 
-	wsURL := "wss://streaming.assemblyai.com/v3/ws?sample_rate=16000&token=" + token
-	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, assemblyWsURL(upstream.BaseURL, token, language), nil)
+	if err != nil {
+		upstreamConnectFailures.With("dial").Inc()
+		return nil, resp, fmt.Errorf("failed to dial assembly: %w", err)
+	}
 
-	if resp.StatusCode != 101 { 
+	if resp.StatusCode != 101 {
+		upstreamConnectFailures.With("dial").Inc()
 		return nil, resp, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
 	return conn, resp, err
 }
 
+// AssemblyTranscriber speaks AssemblyAI's v3 streaming protocol.
+type AssemblyTranscriber struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func NewAssemblyTranscriber(ctx context.Context, upstream config.UpstreamConfig, language string) (Transcriber, error) {
+	conn, res, err := ConnectToAssemblyAI(ctx, upstream, language)
+	if err != nil {
+		if res != nil {
+			slog.Error("assembly connect failed", "status", res.Status, "err", err)
+		} else {
+			slog.Error("assembly connect failed", "err", err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+	return &AssemblyTranscriber{conn: conn}, nil
+}
+
+func (a *AssemblyTranscriber) SendAudio(audio []byte) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	upstreamMessages.With("audio").Inc()
+	return a.conn.WriteMessage(websocket.BinaryMessage, audio)
+}
+
+func (a *AssemblyTranscriber) Receive() (*TranscriptEvent, error) {
+	msgType, msg, err := a.conn.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTranscriberClosed, err)
+	}
+	if msgType != websocket.TextMessage {
+		return nil, errors.New("from assembly, this is not a text message")
+	}
+
+	var parsed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg, &parsed); err != nil {
+		return nil, errors.Join(errors.New("cant parse json from Assembly: "), err)
+	}
+
+	switch parsed.Type {
+	case "Begin":
+		slog.Debug("assembly session began", "message", string(msg))
+		return &TranscriptEvent{Type: TRANSCRIPT_BEGIN}, nil
+	case "Termination":
+		return &TranscriptEvent{Type: TRANSCRIPT_TERMINATION}, nil
+	case "Turn":
+		var turn AssemblyRessponseTurn
+		if err := json.Unmarshal(msg, &turn); err != nil {
+			return nil, errors.Join(errors.New("cant parse json from Assembly: "), err)
+		}
+		for i := range turn.Words {
+			if turn.Words[i].Speaker == "" {
+				turn.Words[i].Speaker = turn.SpeakerLabel
+			}
+		}
+		return &TranscriptEvent{
+			Type: TRANSCRIPT_TURN,
+			Turn: &TranscriptTurn{
+				TurnOrder:  turn.TurnOrder,
+				Transcript: turn.Transcript,
+				EndOfTurn:  turn.EndOfTurn,
+				Speaker:    turn.SpeakerLabel,
+				Words:      turn.Words,
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown message type from assembly: %q", parsed.Type)
+}
+
+func (a *AssemblyTranscriber) Terminate() error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	upstreamMessages.With("terminate").Inc()
+	return a.conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"Terminate"}`))
+}
+
+func (a *AssemblyTranscriber) ForceEndOfTurn() error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	upstreamMessages.With("force_endpoint").Inc()
+	return a.conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ForceEndpoint"}`))
+}
+
+func (a *AssemblyTranscriber) Close() error {
+	return a.conn.Close()
+}
+
 type ResponseAssemblyToken struct {
 	Token            string `json:"token"`
 	ExpiresInSeconds int    `json:"expires_in_seconds"`
 }
 
-func getStreamingToken(apiKey string, expiredTime int) (string, error) {
-    baseURL := "https://streaming.assemblyai.com/v3/token?expires_in_seconds=" + fmt.Sprint(expiredTime)
-
-    req, err := http.NewRequest("GET", baseURL, nil)
-    if err != nil {
-        return "", fmt.Errorf("failed to create request: %w", err)
-    }
-    req.Header.Set("Authorization", apiKey)
-
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    if err != nil {
-        return "", fmt.Errorf("failed to do request: %w", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        bodyBytes, _ := io.ReadAll(resp.Body)
-        return "", fmt.Errorf("non-200 response: %d - %s", resp.StatusCode, string(bodyBytes))
-    }
-
-    body, err := io.ReadAll(resp.Body)
-    if err != nil {
-        return "", fmt.Errorf("failed to read response body: %w", err)
-    }
-
-    var result ResponseAssemblyToken
-    if err := json.Unmarshal(body, &result); err != nil {
-        return "", fmt.Errorf("failed to parse JSON response: %w\nResponse body: %s", err, string(body))
-    }
-
-    return result.Token, nil
+// CheckAssemblyAI mints a short lived streaming token to tell whether new sessions can start.
+func CheckAssemblyAI(ctx context.Context, upstream config.UpstreamConfig) error {
+	_, err := getStreamingToken(ctx, upstream.BaseURL, upstream.ApiKey, 1)
+	return err
 }
 
+func getStreamingToken(ctx context.Context, baseURL string, apiKey string, expiredTime int) (string, error) {
+	start := time.Now()
+	defer func() {
+		tokenFetchLatency.Observe(time.Since(start).Seconds())
+	}()
+	tokenURL := strings.TrimRight(baseURL, "/") + "/v3/token?expires_in_seconds=" + fmt.Sprint(expiredTime)
 
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", apiKey)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("non-200 response: %d - %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var result ResponseAssemblyToken
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse JSON response: %w\nResponse body: %s", err, string(body))
+	}
+
+	return result.Token, nil
+}
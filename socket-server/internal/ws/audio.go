@@ -0,0 +1,242 @@
+package ws
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+type AUDIO_ENCODING string
+
+const (
+	AUDIO_PCM16   AUDIO_ENCODING = "pcm16"
+	AUDIO_FLOAT32 AUDIO_ENCODING = "float32"
+	AUDIO_MULAW   AUDIO_ENCODING = "mulaw"
+)
+
+// What the transcriber is fed: 16kHz 16-bit mono pcm.
+const (
+	AUDIO_SAMPLE_RATE      = 16000
+	AUDIO_BYTES_PER_SECOND = AUDIO_SAMPLE_RATE * 2
+)
+
+const (
+	minSampleRate = 8000
+	maxSampleRate = 192000
+	maxChannels   = 8
+)
+
+// AudioFormat is what the client streams, declared on connect with
+// ?sample_rate=48000&channels=2&encoding=float32.
+type AudioFormat struct {
+	SampleRate int
+	Channels   int
+	Encoding   AUDIO_ENCODING
+}
+
+var ProviderAudioFormat = AudioFormat{
+	SampleRate: AUDIO_SAMPLE_RATE,
+	Channels:   1,
+	Encoding:   AUDIO_PCM16,
+}
+
+// ParseAudioFormat reads the format from the query, missing values fall back to the provider format.
+func ParseAudioFormat(query url.Values) (AudioFormat, error) {
+	format := ProviderAudioFormat
+
+	if rate := query.Get("sample_rate"); rate != "" {
+		sampleRate, err := strconv.Atoi(rate)
+		if err != nil {
+			return format, fmt.Errorf("invalid sample_rate: %s", rate)
+		}
+		format.SampleRate = sampleRate
+	}
+	if channels := query.Get("channels"); channels != "" {
+		n, err := strconv.Atoi(channels)
+		if err != nil {
+			return format, fmt.Errorf("invalid channels: %s", channels)
+		}
+		format.Channels = n
+	}
+	if encoding := query.Get("encoding"); encoding != "" {
+		format.Encoding = AUDIO_ENCODING(encoding)
+	}
+
+	return format, format.Validate()
+}
+
+func (f AudioFormat) Validate() error {
+	if f.SampleRate < minSampleRate || f.SampleRate > maxSampleRate {
+		return fmt.Errorf("sample_rate must be between %d and %d", minSampleRate, maxSampleRate)
+	}
+	if f.Channels < 1 || f.Channels > maxChannels {
+		return fmt.Errorf("channels must be between 1 and %d", maxChannels)
+	}
+	switch f.Encoding {
+	case AUDIO_PCM16, AUDIO_FLOAT32, AUDIO_MULAW:
+		return nil
+	}
+	return fmt.Errorf("unsupported encoding: %s", f.Encoding)
+}
+
+func (f AudioFormat) BytesPerSample() int {
+	switch f.Encoding {
+	case AUDIO_FLOAT32:
+		return 4
+	case AUDIO_MULAW:
+		return 1
+	}
+	return 2
+}
+
+func (f AudioFormat) frameSize() int {
+	return f.BytesPerSample() * f.Channels
+}
+
+// AudioConverter decodes, downmixes to mono and resamples a client stream
+// into the provider format. Chunks may split frames, the state carries over.
+type AudioConverter struct {
+	From AudioFormat
+	To   AudioFormat
+
+	leftover []byte
+	// resampler state: position of the next output sample, index 0 is prev
+	pos  float64
+	prev float64
+	// box filter history used when downsampling
+	history []float64
+}
+
+func NewAudioConverter(from AudioFormat) *AudioConverter {
+	return &AudioConverter{
+		From: from,
+		To:   ProviderAudioFormat,
+		pos:  1,
+	}
+}
+
+func (a *AudioConverter) Passthrough() bool {
+	return a.From == a.To
+}
+
+func (a *AudioConverter) Convert(chunk []byte) []byte {
+	if a.Passthrough() {
+		return chunk
+	}
+
+	data := chunk
+	if len(a.leftover) > 0 {
+		data = append(a.leftover, chunk...)
+		a.leftover = nil
+	}
+	frameSize := a.From.frameSize()
+	usable := len(data) - len(data)%frameSize
+	if usable < len(data) {
+		a.leftover = append([]byte(nil), data[usable:]...)
+	}
+
+	mono := a.decodeMono(data[:usable])
+	resampled := a.resample(mono)
+	return encodePCM16(resampled)
+}
+
+func (a *AudioConverter) decodeMono(data []byte) []float64 {
+	bytesPerSample := a.From.BytesPerSample()
+	frameSize := a.From.frameSize()
+	samples := make([]float64, 0, len(data)/frameSize)
+
+	for frame := 0; frame+frameSize <= len(data); frame += frameSize {
+		sum := 0.0
+		for ch := 0; ch < a.From.Channels; ch++ {
+			offset := frame + ch*bytesPerSample
+			switch a.From.Encoding {
+			case AUDIO_PCM16:
+				sum += float64(int16(binary.LittleEndian.Uint16(data[offset:]))) / 32768
+			case AUDIO_FLOAT32:
+				sum += float64(math.Float32frombits(binary.LittleEndian.Uint32(data[offset:])))
+			case AUDIO_MULAW:
+				sum += float64(decodeMulaw(data[offset])) / 32768
+			}
+		}
+		samples = append(samples, sum/float64(a.From.Channels))
+	}
+	return samples
+}
+
+// resample uses linear interpolation, with a box filter in front when
+// downsampling so 44.1/48kHz input doesn't alias into the speech band.
+func (a *AudioConverter) resample(samples []float64) []float64 {
+	if a.From.SampleRate == a.To.SampleRate || len(samples) == 0 {
+		return samples
+	}
+	step := float64(a.From.SampleRate) / float64(a.To.SampleRate)
+
+	if width := int(math.Round(step)); width > 1 {
+		samples = a.boxFilter(samples, width)
+	}
+
+	buf := make([]float64, 0, len(samples)+1)
+	buf = append(buf, a.prev)
+	buf = append(buf, samples...)
+
+	out := make([]float64, 0, int(float64(len(samples))/step)+1)
+	last := float64(len(buf) - 1)
+	for a.pos <= last {
+		i := int(a.pos)
+		frac := a.pos - float64(i)
+		sample := buf[i]
+		if i+1 < len(buf) {
+			sample = buf[i]*(1-frac) + buf[i+1]*frac
+		}
+		out = append(out, sample)
+		a.pos += step
+	}
+	a.pos -= last
+	a.prev = buf[len(buf)-1]
+	return out
+}
+
+func (a *AudioConverter) boxFilter(samples []float64, width int) []float64 {
+	if a.history == nil {
+		a.history = make([]float64, width-1)
+	}
+	buf := append(a.history, samples...)
+	out := make([]float64, len(samples))
+
+	sum := 0.0
+	for i := 0; i < width-1; i++ {
+		sum += buf[i]
+	}
+	for i := range samples {
+		sum += buf[i+width-1]
+		out[i] = sum / float64(width)
+		sum -= buf[i]
+	}
+	a.history = append([]float64(nil), buf[len(buf)-(width-1):]...)
+	return out
+}
+
+func encodePCM16(samples []float64) []byte {
+	out := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		sample = math.Max(-1, math.Min(1, sample))
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(int16(math.Round(sample*32767))))
+	}
+	return out
+}
+
+// decodeMulaw expands a G.711 mu-law byte to a 16-bit sample.
+func decodeMulaw(b byte) int16 {
+	b = ^b
+	sign := b & 0x80
+	exponent := (b >> 4) & 0x07
+	mantissa := b & 0x0F
+	magnitude := ((int16(mantissa) << 3) + 0x84) << exponent
+	magnitude -= 0x84
+	if sign != 0 {
+		return -magnitude
+	}
+	return magnitude
+}
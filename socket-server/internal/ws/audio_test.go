@@ -0,0 +1,118 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// float32Stereo is seconds of a sine per channel at 48kHz, interleaved little-endian float32.
+func float32Stereo(seconds float64, freq float64, left, right float64) []byte {
+	n := int(seconds * 48000)
+	out := make([]byte, 0, n*8)
+	for i := range n {
+		s := math.Sin(2 * math.Pi * freq * float64(i) / 48000)
+		out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(left*s)))
+		out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(right*s)))
+	}
+	return out
+}
+
+func pcm16Samples(data []byte) []float64 {
+	samples := make([]float64, len(data)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(data[i*2:]))) / 32767
+	}
+	return samples
+}
+
+func peak(samples []float64) float64 {
+	p := 0.0
+	for _, s := range samples {
+		p = max(p, math.Abs(s))
+	}
+	return p
+}
+
+func TestAudioConverterPassthrough(t *testing.T) {
+	a := NewAudioConverter(ProviderAudioFormat)
+	if !a.Passthrough() {
+		t.Fatal("provider format is converted")
+	}
+	// an odd chunk isn't held back either, the provider gets what the browser sent
+	chunk := []byte{1, 2, 3, 4, 5}
+	if got := a.Convert(chunk); !bytes.Equal(got, chunk) {
+		t.Errorf("Convert = %v, want %v", got, chunk)
+	}
+}
+
+func TestAudioConverterFloat32StereoTo16kMono(t *testing.T) {
+	a := NewAudioConverter(AudioFormat{SampleRate: 48000, Channels: 2, Encoding: AUDIO_FLOAT32})
+	// the channels are averaged: (0.6 + 0.2) / 2
+	out := pcm16Samples(a.Convert(float32Stereo(1, 440, 0.6, 0.2)))
+
+	if n := len(out); n < AUDIO_SAMPLE_RATE-1 || n > AUDIO_SAMPLE_RATE {
+		t.Fatalf("1s of 48kHz gave %d samples, want %d", n, AUDIO_SAMPLE_RATE)
+	}
+	// past the filter warm-up, the box filter barely touches 440Hz
+	if p := peak(out[100:]); math.Abs(p-0.4) > 0.01 {
+		t.Errorf("sine peak %.3f, want 0.4", p)
+	}
+}
+
+func TestAudioConverterMulaw8kTo16k(t *testing.T) {
+	tests := []struct {
+		in   byte
+		want int16
+	}{
+		{0xFF, 0},
+		{0x7F, 0},
+		{0x80, 32124},
+		{0x00, -32124},
+		{0xF0, 120},
+		{0x70, -120},
+	}
+	for _, tt := range tests {
+		if got := decodeMulaw(tt.in); got != tt.want {
+			t.Errorf("decodeMulaw(%#x) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	a := NewAudioConverter(AudioFormat{SampleRate: 8000, Channels: 1, Encoding: AUDIO_MULAW})
+	out := pcm16Samples(a.Convert(bytes.Repeat([]byte{0x80}, 8000)))
+	if n := len(out); n < 2*8000-1 || n > 2*8000 {
+		t.Fatalf("1s of 8kHz gave %d samples, want %d", n, 2*8000)
+	}
+	want := 32124.0 / 32768
+	for i, s := range out {
+		if math.Abs(s-want) > 1e-4 {
+			t.Fatalf("sample %d = %.5f, want %.5f", i, s, want)
+		}
+	}
+}
+
+func TestAudioConverterFramesSplitAcrossChunks(t *testing.T) {
+	formats := []AudioFormat{
+		{SampleRate: 48000, Channels: 2, Encoding: AUDIO_FLOAT32},
+		{SampleRate: 44100, Channels: 2, Encoding: AUDIO_PCM16},
+		{SampleRate: 8000, Channels: 1, Encoding: AUDIO_MULAW},
+	}
+	audio := float32Stereo(0.5, 300, 0.5, -0.25)
+
+	for _, format := range formats {
+		t.Run(string(format.Encoding), func(t *testing.T) {
+			whole := NewAudioConverter(format).Convert(audio)
+
+			split := NewAudioConverter(format)
+			var parts []byte
+			// cuts mid sample and mid frame
+			for _, chunk := range [][]byte{audio[:1001], audio[1001:4099], audio[4099:]} {
+				parts = append(parts, split.Convert(chunk)...)
+			}
+			if !bytes.Equal(parts, whole) {
+				t.Errorf("split chunks gave %d bytes differing from the %d of one call", len(parts), len(whole))
+			}
+		})
+	}
+}
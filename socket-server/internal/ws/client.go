@@ -1,58 +1,260 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/service"
+	"meetingmind-socket/internal/validation"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"golang.org/x/sync/errgroup"
+)
+
+// Why a session ended, the cause of the client context once Close ran.
+var (
+	ErrClientClosed   = errors.New("client closed the connection")
+	ErrClientLost     = errors.New("client connection lost")
+	ErrResumeExpired  = errors.New("resume window passed")
+	ErrSessionExpired = errors.New("session reached its max length")
+	ErrTooManyErrors  = errors.New("too many errors")
+	ErrUpstreamEnded  = errors.New("upstream session terminated")
+	ErrTakenOver      = errors.New("taken over by a new session")
+	ErrAbandoned      = errors.New("detached session replaced by a new session")
+	ErrTerminated     = errors.New("terminated by an admin")
+	ErrTokenExpired   = errors.New("access token expired")
+	ErrQuotaExhausted = errors.New("usage quota exhausted")
+	ErrServerDraining = errors.New("server is shutting down")
 )
 
 type Client struct {
-	UserId         string
-	Conn           *websocket.Conn
-	AssemblyConn   *websocket.Conn
-	Done           chan struct{}
+	UserId      string
+	SessionId   string
+	Conn        *websocket.Conn
+	Transcriber Transcriber
+	Audio       *AudioConverter
+	// nil unless RecordingStorage is set
+	Recorder       *Recorder
 	Transcript     *TranscriptState
-	TranscriptWord chan (*TranscriptWriter)
-	TranslateWord  chan (*TranslateWriter)
+	Translator     Translator
+	targetLanguage string
+	language       string
 	Mu             sync.Mutex
 	StartTime      time.Time
 	ExpiresAt      time.Time
+	audioBytes     atomic.Int64
+	paused         atomic.Bool
+	cfg            *config.Config
+	// the plan limits of the user, set before the session starts
+	Entitlement   service.Entitlement
+	maxSessions   int
+	expiryMessage string
+	// carries user, session and remote address on every line
+	Logger *slog.Logger
+	// unix nanos of the last audio sent upstream, for the transcript latency
+	lastAudioAt atomic.Int64
+	// shared with the other sessions of the user, nil when billing isn't enforced, see usage.go
+	meter          *usageMeter
+	quotaExhausted atomic.Bool
+	// holds an UPSTREAM_STATE, see upstream.go
+	upstreamState atomic.Value
+
+	// decouple the upstream reader from translation and the browser, see queue.go
+	transcriptOut *queue[*TranscriptWriter]
+	translateIn   *queue[*TranscriptTurn]
+	translateOut  *queue[*TranslateWriter]
+	// set once a queue overflowed, cleared when the browser reattaches
+	slow atomic.Bool
+	// the browser is gone and the session waits for resume, read without Mu by the registry
+	detached atomic.Bool
+
+	// cancelled with the reason the session ended, see Close
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	closeOnce sync.Once
+	// every session goroutine runs in group, the transcript is saved once they all returned
+	group errgroup.Group
+
+	// guarded by Mu, see session.go
+	seq         int64
+	replay      []replayEntry
+	resumeTimer *time.Timer
+	bookmarks   []Bookmark
+
+	// checks refreshed tokens, guarded by Mu otherwise, see token.go
+	verifier       *validation.Verifier
+	tokenExpiresAt time.Time
+	tokenTimer     *time.Timer
+
+	// set from the Server before the session starts, see persist.go and usage.go
+	saveSessionFn SessionSaver
+	recordUsageFn UsageRecorder
+
+	// set once before the client goroutines start, see room.go
+	room       *Room
+	roomMember *roomMember
 }
 
-func NewClient(UserId string, Conn *websocket.Conn, AssemblyConn *websocket.Conn) *Client {
-	return &Client{
-		UserId:         UserId,
-		Conn:           Conn,
-		AssemblyConn:   AssemblyConn,
-		Done:           make(chan struct{}),
-		Transcript:     NewTranscriptState(),
-		TranscriptWord: make(chan *TranscriptWriter),
-		TranslateWord:  make(chan *TranslateWriter),
-		Mu:             sync.Mutex{},
-		StartTime:      time.Now(),
-		ExpiresAt:      time.Now().Add(30 * time.Minute), 
+func NewClient(cfg *config.Config, UserId string, Conn *websocket.Conn, Transcriber Transcriber) *Client {
+	sessionId := uuid.NewString()
+	logger := slog.Default().With("user_id", UserId, "session_id", sessionId)
+	if Conn != nil {
+		logger = logger.With("remote_addr", Conn.RemoteAddr().String())
 	}
+	client := &Client{
+		UserId:        UserId,
+		SessionId:     sessionId,
+		Conn:          Conn,
+		Transcriber:   Transcriber,
+		Audio:         NewAudioConverter(ProviderAudioFormat),
+		Transcript:    NewTranscriptState(),
+		language:      DEFAULT_SOURCE_LANGUAGE,
+		Mu:            sync.Mutex{},
+		StartTime:     time.Now(),
+		ExpiresAt:     time.Now().Add(cfg.Session.MaxLength),
+		expiryMessage: fmt.Sprintf("Your %d-minute session has expired", int(cfg.Session.MaxLength.Minutes())),
+		cfg:           cfg,
+		Logger:        logger,
+	}
+	client.ctx, client.cancel = context.WithCancelCause(context.Background())
+	queueSize := cfg.Session.QueueSize
+	// partials of a turn are coalesced, only partials without final words are dropped
+	client.transcriptOut = newQueue[*TranscriptWriter](STREAM_TRANSCRIPT, queueSize)
+	client.transcriptOut.merge = mergePartials
+	client.transcriptOut.droppable = droppablePartial
+	client.transcriptOut.full = func() { client.slowConsumer(STREAM_TRANSCRIPT) }
+	// finished turns are never dropped, the transcript waits for a translator that falls behind
+	client.translateIn = newQueue[*TranscriptTurn](STREAM_TRANSLATE_INPUT, queueSize)
+	client.translateIn.full = func() {
+		slowConsumers.With(STREAM_TRANSLATE_INPUT).Inc()
+		client.Logger.Warn("translator can't keep up, the transcript waits for it")
+	}
+	client.translateOut = newQueue[*TranslateWriter](STREAM_TRANSLATE, queueSize)
+	client.translateOut.full = func() { client.slowConsumer(STREAM_TRANSLATE) }
+	client.setUpstreamState(UPSTREAM_CONNECTED)
+	return client
 }
 
-func RegisterClient(client *Client) {
-	log.Println("Registering new client: ", client.UserId)
+// TargetLanguage is the language finalized turns are translated to, empty disables translation.
+func (c *Client) TargetLanguage() string {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return c.targetLanguage
+}
 
-	go client.processClientAudio()
-	go client.processMsgTranscript()
+// canTranslate tells whether the server translates at all, whatever the plan of the user.
+func (c *Client) canTranslate() bool {
+	return c.cfg.Features.Translation && c.Translator != nil
+}
 
-	go client.readTranslate()
+func (c *Client) SetTargetLanguage(language string) {
+	c.Mu.Lock()
+	c.targetLanguage = language
+	c.Mu.Unlock()
+}
 
-	go client.sendMsgTranscript()
-	go client.sendMsgTranslate()
+// Language is the spoken language of the session.
+func (c *Client) Language() string {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return c.language
+}
 
+func (c *Client) SetLanguage(language string) {
+	c.Mu.Lock()
+	c.language = language
+	c.Mu.Unlock()
 }
 
-func UnregisterClient(c *Client) {
-	_, ok := <-c.Done
-	if ok {
-		close(c.Done)
+// RegisterClient starts the session of an admitted client, it is registered once it runs.
+func RegisterClient(client *Client) {
+	client.Logger.Info("registering new client")
+
+	sessionMsg := NewStatusWriter(SESSION_RESPONSE, "")
+	sessionMsg.SessionId = client.SessionId
+	client.send(sessionMsg)
+	client.send(client.planMessage())
+
+	conn := client.Conn
+	client.spawn("processClientAudio", func(ctx context.Context) error { return client.processClientAudio(ctx, conn) })
+	client.spawn("processMsgTranscript", client.processMsgTranscript)
+
+	client.spawn("readTranslate", client.readTranslate)
+
+	client.spawn("sendMsgTranscript", client.sendMsgTranscript)
+	client.spawn("sendMsgTranslate", client.sendMsgTranslate)
+
+	// last, the admin API and Drain read the session once it is registered
+	if !registerSession(client) {
+		client.Logger.Info("session ended before it was registered", "cause", client.Cause())
 	}
-	log.Println("Unregistered client: ", c.UserId)
+}
+
+// spawn runs fn in the session group. fn returns nil when it stops without ending the session,
+// like the reader of a detached connection, any error ends the session with it as the cause.
+func (c *Client) spawn(name string, fn func(ctx context.Context) error) {
+	c.group.Go(func() error {
+		err := fn(c.ctx)
+		c.Logger.Debug("session goroutine returned", "goroutine", name, "err", err)
+		if err != nil {
+			c.Close(err)
+		}
+		return err
+	})
+}
+
+// Close ends the session, only the first call does anything. Both the browser and the upstream
+// socket are closed so every session goroutine returns, the session is saved once they did.
+func (c *Client) Close(cause error) {
+	c.closeOnce.Do(func() {
+		c.cancel(cause)
+		// registered before the session leaves the registry, Drain waits for saves once it is empty
+		pendingSaves.Add(1)
+		removeSession(c)
+
+		c.Mu.Lock()
+		if c.resumeTimer != nil {
+			c.resumeTimer.Stop()
+		}
+		if c.tokenTimer != nil {
+			c.tokenTimer.Stop()
+		}
+		if c.Conn != nil {
+			c.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"),
+				time.Now().Add(time.Second))
+			c.Conn.Close()
+		}
+		c.Mu.Unlock()
+		c.Transcriber.Close()
+		c.setUpstreamState(UPSTREAM_CLOSED)
+		c.leaveRoom()
+		sessionDuration.Observe(time.Since(c.StartTime).Seconds())
+		c.Logger.Info("unregistered client", "cause", cause)
+
+		go func() {
+			defer pendingSaves.Done()
+			c.group.Wait()
+			c.transcriptOut.discard()
+			c.translateIn.discard()
+			c.translateOut.discard()
+			// saved first so the ledger knows whether the audio file counts the session
+			c.recordUsage(c.saveSession())
+		}()
+	})
+}
+
+// Cause is why the session ended, nil while it is live.
+func (c *Client) Cause() error {
+	return context.Cause(c.ctx)
+}
+
+func (c *Client) isClosed() bool {
+	return c.ctx.Err() != nil
 }
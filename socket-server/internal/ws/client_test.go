@@ -0,0 +1,273 @@
+package ws
+
+import (
+	"context"
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/fakeassembly"
+	"meetingmind-socket/internal/models"
+	"meetingmind-socket/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Stack frames of goroutines that belong to a session, or to the upstream stream of one.
+var sessionFrames = []string{
+	"meetingmind-socket/internal/ws.(*Client)",
+	"meetingmind-socket/internal/ws.(*queue",
+	"meetingmind-socket/internal/fakeassembly.(*Server).handleStream",
+}
+
+// TestClientGoroutinesExit checks that every goroutine of a session returns and
+// both sockets are closed once the session ends, whichever way it ends.
+func TestClientGoroutinesExit(t *testing.T) {
+	tests := []struct {
+		name   string
+		resume bool
+		end    func(t *testing.T, conn *websocket.Conn)
+	}{
+		{
+			name: "browser closes normally",
+			end: func(t *testing.T, conn *websocket.Conn) {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				conn.Close()
+			},
+		},
+		{
+			name: "browser connection drops",
+			end: func(t *testing.T, conn *websocket.Conn) {
+				conn.Close()
+			},
+		},
+		{
+			name:   "resume window passes",
+			resume: true,
+			end: func(t *testing.T, conn *websocket.Conn) {
+				conn.Close()
+			},
+		},
+		{
+			name: "browser stops the transcription",
+			end: func(t *testing.T, conn *websocket.Conn) {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"stop"}`)); err != nil {
+					t.Fatal(err)
+				}
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						break
+					}
+				}
+				conn.Close()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, _ := startTestServer(t, func(s *Server) {
+				s.Config.Features.Resume = tt.resume
+				s.Config.Session.ResumeGraceWindow = 100 * time.Millisecond
+			})
+
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "session to start", func() bool { return countSessions() == 1 })
+			// enough audio for the fake to send a few turns
+			for range 10 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.end(t, conn)
+
+			waitFor(t, "session to end", func() bool { return countSessions() == 0 })
+			// the session is saved once its goroutines returned
+			saved := make(chan struct{})
+			go func() {
+				WaitForSaves()
+				close(saved)
+			}()
+			waitFor(t, "session to be saved", func() bool {
+				select {
+				case <-saved:
+					return true
+				default:
+					return false
+				}
+			})
+			waitFor(t, "session goroutines to exit", func() bool { return len(sessionGoroutines()) == 0 })
+		})
+	}
+}
+
+// TestTranscriptEndToEnd streams audio from a browser through RunServer to the fake AssemblyAI
+// and checks the turns of the hello fixture come back to the browser in order.
+func TestTranscriptEndToEnd(t *testing.T) {
+	url, fake := startTestServer(t, func(s *Server) {})
+	conn := dialSession(t, url)
+	readUntil(t, conn, SESSION_RESPONSE)
+
+	// 48000 bytes, every step of the fixture
+	for range 15 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type turn struct{ speaker, text string }
+	want := []turn{{"A", "hello world"}, {"B", "this is a test"}}
+	var got []turn
+	var words []string
+	for len(got) < len(want) {
+		msg := readUntil(t, conn, TRANSCRIPT_RESPONSE)
+		for _, w := range msg["words"].([]any) {
+			word := w.(map[string]any)
+			if word["word_is_final"] == true {
+				words = append(words, word["text"].(string))
+			}
+		}
+		if msg["isEndOfTurn"] == true {
+			speaker, _ := msg["speaker"].(string)
+			got = append(got, turn{speaker, strings.Join(words, " ")})
+			words = nil
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("turns = %+v, want %+v", got, want)
+	}
+	if n := fake.Sessions(); n != 1 {
+		t.Fatalf("upstream sessions = %d, want 1", n)
+	}
+}
+
+// startTestServer serves /ws against a fake AssemblyAI and returns a url with a valid token.
+func startTestServer(t *testing.T, tweak func(s *Server)) (string, *fakeassembly.Server) {
+	t.Helper()
+	script, err := fakeassembly.LoadFixture("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srvFake, fake := fakeassembly.Start("test-key", script)
+	t.Cleanup(srvFake.Close)
+
+	cfg := config.Default()
+	cfg.SupabaseJwtKey = "test-secret"
+	cfg.AllowAnyOrigin = true
+	cfg.Upstream.ApiKey = "test-key"
+	cfg.Upstream.BaseURL = srvFake.URL
+	// sessions end with their connection unless a test turns resume on
+	cfg.Features.Resume = false
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing is read from or written to a database, users are on the free plan with nothing used
+	s.LookupEntitlement = func(ctx context.Context, userId string, now time.Time) (service.Entitlement, error) {
+		return service.Entitlement{Plan: service.Plans[service.PLAN_FREE], PeriodStart: service.UsagePeriodStart(now)}, nil
+	}
+	s.SaveSession = func(ctx context.Context, ls service.LiveSession) (models.AudioFile, error) {
+		return models.AudioFile{}, nil
+	}
+	s.RecordUsage = func(ctx context.Context, userId string, sessionId string, audioId string, periodStart time.Time, audioSeconds int) error {
+		return nil
+	}
+	tweak(s)
+
+	srv := httptest.NewServer(http.HandlerFunc(s.RunServer))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?token=" + testToken(t, "test-user", time.Hour), fake
+}
+
+// testToken signs an access token of userId that expires in ttl, with the secret of startTestServer.
+func testToken(t *testing.T, userId string, ttl time.Duration) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  userId,
+		"aud":  "authenticated",
+		"role": "authenticated",
+		"exp":  time.Now().Add(ttl).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// withToken swaps the token of a startTestServer url.
+func withToken(url string, token string) string {
+	base, _, _ := strings.Cut(url, "?")
+	return base + "?token=" + token
+}
+
+// sessionGoroutines returns the stacks of the goroutines still running session code.
+func sessionGoroutines() []string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	var found []string
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		for _, frame := range sessionFrames {
+			if strings.Contains(stack, frame) {
+				found = append(found, stack)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// dialSession opens a session that is ended, and saved, when the test finishes.
+func dialSession(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// a normal close ends the session even with resume on
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+		waitFor(t, "session to end", func() bool { return countSessions() == 0 })
+		WaitForSaves()
+	})
+	return conn
+}
+
+// readUntil reads messages from the browser side until one of the given type arrives.
+func readUntil(t *testing.T, conn *websocket.Conn, messageType RESPONSE_TYPE) map[string]any {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("no %s message: %v", messageType, err)
+		}
+		if msg["type"] == string(messageType) {
+			return msg
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, still running:\n%s", what, strings.Join(sessionGoroutines(), "\n\n"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
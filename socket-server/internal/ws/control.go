@@ -0,0 +1,244 @@
+package ws
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+type CONTROL_TYPE string
+
+const (
+	CONTROL_START             CONTROL_TYPE = "start"
+	CONTROL_STOP              CONTROL_TYPE = "stop"
+	CONTROL_PAUSE             CONTROL_TYPE = "pause"
+	CONTROL_RESUME            CONTROL_TYPE = "resume"
+	CONTROL_SET_LANGUAGE      CONTROL_TYPE = "set_language"
+	CONTROL_SET_TRANSLATION   CONTROL_TYPE = "set_translation"
+	CONTROL_FORCE_END_OF_TURN CONTROL_TYPE = "force_end_of_turn"
+	CONTROL_BOOKMARK          CONTROL_TYPE = "bookmark"
+	CONTROL_RENAME_SPEAKER    CONTROL_TYPE = "rename_speaker"
+	CONTROL_REFRESH_TOKEN     CONTROL_TYPE = "refresh_token"
+)
+
+type CONTROL_ERROR_CODE string
+
+const (
+	CONTROL_ERR_INVALID_MESSAGE      CONTROL_ERROR_CODE = "invalid_message"
+	CONTROL_ERR_UNKNOWN_CONTROL      CONTROL_ERROR_CODE = "unknown_control"
+	CONTROL_ERR_INVALID_STATE        CONTROL_ERROR_CODE = "invalid_state"
+	CONTROL_ERR_UNSUPPORTED_LANGUAGE CONTROL_ERROR_CODE = "unsupported_language"
+	CONTROL_ERR_UPSTREAM             CONTROL_ERROR_CODE = "upstream_error"
+	CONTROL_ERR_INVALID_TOKEN        CONTROL_ERROR_CODE = "invalid_token"
+)
+
+const (
+	ACK_RESPONSE           RESPONSE_TYPE = "ack"
+	CONTROL_ERROR_RESPONSE RESPONSE_TYPE = "control_error"
+)
+
+// ControlMessage is a text frame sent by the browser.
+// Id is optional and echoed back in the ack or error.
+type ControlMessage struct {
+	Type     CONTROL_TYPE `json:"type"`
+	Id       string       `json:"id,omitempty"`
+	Language string       `json:"language,omitempty"`
+	Label    string       `json:"label,omitempty"`
+	Speaker  string       `json:"speaker,omitempty"`
+	Name     string       `json:"name,omitempty"`
+	Token    string       `json:"token,omitempty"`
+}
+
+type ControlError struct {
+	Code    CONTROL_ERROR_CODE
+	Message string
+}
+
+func (e *ControlError) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+type AckWriter struct {
+	Sequenced
+	Type    RESPONSE_TYPE `json:"type"`
+	Id      string        `json:"id,omitempty"`
+	Control CONTROL_TYPE  `json:"control"`
+	Data    any           `json:"data,omitempty"`
+}
+
+type ControlErrorWriter struct {
+	Sequenced
+	Type    RESPONSE_TYPE      `json:"type"`
+	Id      string             `json:"id,omitempty"`
+	Control CONTROL_TYPE       `json:"control,omitempty"`
+	Code    CONTROL_ERROR_CODE `json:"code"`
+	Message string             `json:"message"`
+}
+
+type Bookmark struct {
+	Label string    `json:"label"`
+	AtMs  int64     `json:"atMs"`
+	At    time.Time `json:"at"`
+}
+
+type controlHandler func(c *Client, msg *ControlMessage) (any, *ControlError)
+
+var controlHandlers = map[CONTROL_TYPE]controlHandler{
+	CONTROL_START:             (*Client).handleStart,
+	CONTROL_STOP:              (*Client).handleStop,
+	CONTROL_PAUSE:             (*Client).handlePause,
+	CONTROL_RESUME:            (*Client).handleResume,
+	CONTROL_SET_LANGUAGE:      (*Client).handleSetLanguage,
+	CONTROL_SET_TRANSLATION:   (*Client).handleSetTranslation,
+	CONTROL_FORCE_END_OF_TURN: (*Client).handleForceEndOfTurn,
+	CONTROL_BOOKMARK:          (*Client).handleBookmark,
+	CONTROL_RENAME_SPEAKER:    (*Client).handleRenameSpeaker,
+	CONTROL_REFRESH_TOKEN:     (*Client).handleRefreshToken,
+}
+
+// handleControl parses one text frame, runs its handler and answers with an ack or a typed error.
+// It returns false when the frame is not valid json.
+func (c *Client) handleControl(raw []byte) bool {
+	var msg ControlMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		c.sendControlError(&msg, &ControlError{CONTROL_ERR_INVALID_MESSAGE, "control message must be a json object"})
+		return false
+	}
+
+	handler, ok := controlHandlers[msg.Type]
+	if !ok {
+		c.sendControlError(&msg, &ControlError{CONTROL_ERR_UNKNOWN_CONTROL, "unknown control type: " + string(msg.Type)})
+		return true
+	}
+
+	data, controlErr := handler(c, &msg)
+	if controlErr != nil {
+		c.Logger.Warn("control failed", "control", msg.Type, "code", controlErr.Code, "err", controlErr.Message)
+		c.sendControlError(&msg, controlErr)
+		return true
+	}
+
+	c.send(&AckWriter{
+		Type:    ACK_RESPONSE,
+		Id:      msg.Id,
+		Control: msg.Type,
+		Data:    data,
+	})
+	return true
+}
+
+func (c *Client) sendControlError(msg *ControlMessage, controlErr *ControlError) {
+	c.send(&ControlErrorWriter{
+		Type:    CONTROL_ERROR_RESPONSE,
+		Id:      msg.Id,
+		Control: msg.Type,
+		Code:    controlErr.Code,
+		Message: controlErr.Message,
+	})
+}
+
+func (c *Client) controlState() map[string]any {
+	return map[string]any{
+		"sessionId":      c.SessionId,
+		"paused":         c.paused.Load(),
+		"language":       c.Language(),
+		"targetLanguage": c.TargetLanguage(),
+		"expiresAt":      c.ExpiresAt,
+		"tokenExpiresAt": c.TokenExpiresAt(),
+	}
+}
+
+// start is idempotent, it resumes a paused session and reports the session state.
+func (c *Client) handleStart(msg *ControlMessage) (any, *ControlError) {
+	c.paused.Store(false)
+	return c.controlState(), nil
+}
+
+// stop flushes the last turn upstream, the session ends once the provider terminates.
+func (c *Client) handleStop(msg *ControlMessage) (any, *ControlError) {
+	if err := c.terminateUpstream(); err != nil {
+		return nil, &ControlError{CONTROL_ERR_UPSTREAM, "can't stop the transcription: " + err.Error()}
+	}
+	return nil, nil
+}
+
+func (c *Client) handlePause(msg *ControlMessage) (any, *ControlError) {
+	if !c.paused.CompareAndSwap(false, true) {
+		return nil, &ControlError{CONTROL_ERR_INVALID_STATE, "session is already paused"}
+	}
+	return nil, nil
+}
+
+func (c *Client) handleResume(msg *ControlMessage) (any, *ControlError) {
+	if !c.paused.CompareAndSwap(true, false) {
+		return nil, &ControlError{CONTROL_ERR_INVALID_STATE, "session is not paused"}
+	}
+	return nil, nil
+}
+
+// set_language sets the spoken language, used as the translation source and saved with the transcript.
+// The stream is reopened when the language needs another speech model.
+func (c *Client) handleSetLanguage(msg *ControlMessage) (any, *ControlError) {
+	if !slices.Contains(SupportedTranscriptLanguages, msg.Language) {
+		return nil, &ControlError{CONTROL_ERR_UNSUPPORTED_LANGUAGE, "can't transcribe language: " + msg.Language}
+	}
+	if msg.Language != c.Language() {
+		switcher, ok := c.Transcriber.(LanguageSwitcher)
+		if !ok {
+			return nil, &ControlError{CONTROL_ERR_UNSUPPORTED_LANGUAGE, "the stream can't switch to language: " + msg.Language}
+		}
+		if err := switcher.SwitchLanguage(msg.Language); err != nil {
+			return nil, &ControlError{CONTROL_ERR_UPSTREAM, "can't switch language: " + err.Error()}
+		}
+	}
+	c.SetLanguage(msg.Language)
+	return c.controlState(), nil
+}
+
+// set_translation with an empty language turns translation off.
+func (c *Client) handleSetTranslation(msg *ControlMessage) (any, *ControlError) {
+	if !c.canTranslate() {
+		return nil, &ControlError{CONTROL_ERR_INVALID_STATE, "translation is turned off on this server"}
+	}
+	if msg.Language != "" && !c.Entitlement.Plan.Translation {
+		return nil, &ControlError{CONTROL_ERR_INVALID_STATE, "live translation is part of the Pro plan"}
+	}
+	if msg.Language != "" {
+		if supporter, ok := c.Translator.(LanguageSupporter); ok && !supporter.SupportsLanguage(msg.Language) {
+			return nil, &ControlError{CONTROL_ERR_UNSUPPORTED_LANGUAGE, "can't translate to language: " + msg.Language}
+		}
+	}
+	c.SetTargetLanguage(msg.Language)
+	return c.controlState(), nil
+}
+
+func (c *Client) handleForceEndOfTurn(msg *ControlMessage) (any, *ControlError) {
+	if err := c.Transcriber.ForceEndOfTurn(); err != nil {
+		return nil, &ControlError{CONTROL_ERR_UPSTREAM, "can't end the turn: " + err.Error()}
+	}
+	return nil, nil
+}
+
+// bookmark marks the current position in the audio.
+func (c *Client) handleBookmark(msg *ControlMessage) (any, *ControlError) {
+	bookmark := Bookmark{
+		Label: msg.Label,
+		AtMs:  c.audioBytes.Load() * 1000 / AUDIO_BYTES_PER_SECOND,
+		At:    time.Now(),
+	}
+	c.Mu.Lock()
+	c.bookmarks = append(c.bookmarks, bookmark)
+	c.Mu.Unlock()
+	return bookmark, nil
+}
+
+// rename_speaker names a diarization label, e.g. "A" -> "Alice", for the rest of the session.
+func (c *Client) handleRenameSpeaker(msg *ControlMessage) (any, *ControlError) {
+	name := strings.TrimSpace(msg.Name)
+	if msg.Speaker == "" || name == "" {
+		return nil, &ControlError{CONTROL_ERR_INVALID_MESSAGE, "speaker and name are required"}
+	}
+	c.Transcript.SetSpeakerName(msg.Speaker, name)
+	return map[string]string{"speaker": msg.Speaker, "name": name}, nil
+}
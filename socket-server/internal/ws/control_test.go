@@ -0,0 +1,35 @@
+package ws
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSetLanguageSwitchesTheSpeechModel(t *testing.T) {
+	url, fake := startTestServer(t, func(s *Server) {})
+	conn := dialSession(t, url)
+	readUntil(t, conn, READY_RESPONSE)
+
+	setLanguage := func(language string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_language","language":"`+language+`"}`)); err != nil {
+			t.Fatal(err)
+		}
+		ack := readUntil(t, conn, ACK_RESPONSE)
+		if state, _ := ack["data"].(map[string]any); state["language"] != language {
+			t.Fatalf("set_language %s acknowledged with %v", language, ack)
+		}
+	}
+
+	setLanguage("es")
+	readUntil(t, conn, RECOVERED_RESPONSE)
+	// the multilingual model covers french as well, the stream stays open
+	setLanguage("fr")
+
+	want := []string{SPEECH_MODEL_ENGLISH, SPEECH_MODEL_MULTILINGUAL}
+	if models := fake.Models(); !slices.Equal(models, want) {
+		t.Errorf("streams opened with %v, want %v", models, want)
+	}
+}
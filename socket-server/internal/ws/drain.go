@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+func (s *Server) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// Drain stops new sessions, asks connected clients to wrap up and waits for
+// their sessions to end. Sessions still running near the ctx deadline are
+// terminated upstream, early enough for AssemblyAI to flush their last words,
+// whatever is left at the deadline is closed.
+// It returns once every ended session is persisted, at the deadline it waits for
+// the saves of the sessions it closed and returns whatever is still registered.
+func (s *Server) Drain(ctx context.Context) {
+	s.draining.Store(true)
+
+	for _, c := range allSessions() {
+		c.send(NewStatusWriter(DRAINING_RESPONSE, "Server is restarting, please wrap up your meeting"))
+		if c.isDetached() {
+			// nobody can resume it anymore
+			c.terminateUpstream()
+		}
+	}
+
+	terminateIn := time.Duration(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		terminateIn = time.Until(deadline) - s.Config.Drain.TerminateBefore
+	}
+	terminateTimer := time.NewTimer(terminateIn)
+	defer terminateTimer.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for countSessions() > 0 {
+		select {
+		case <-terminateTimer.C:
+			slog.Info("drain: terminating upstream sessions", "sessions", countSessions())
+			for _, c := range allSessions() {
+				c.terminateUpstream()
+			}
+		case <-ctx.Done():
+			slog.Warn("drain: deadline passed, closing sessions", "sessions", countSessions())
+			for _, c := range allSessions() {
+				c.Close(ErrServerDraining)
+			}
+			WaitForSaves()
+			if n := countSessions(); n > 0 {
+				slog.Error("drain: sessions still registered after closing them", "sessions", n)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+
+	WaitForSaves()
+	slog.Info("drain: all sessions ended")
+}
@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"meetingmind-socket/internal/config"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stuckTranscriber never answers a Terminate, its session only ends when it is closed.
+type stuckTranscriber struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newStuckTranscriber() *stuckTranscriber {
+	return &stuckTranscriber{closed: make(chan struct{})}
+}
+
+func (t *stuckTranscriber) SendAudio(audio []byte) error { return nil }
+func (t *stuckTranscriber) Receive() (*TranscriptEvent, error) {
+	<-t.closed
+	return nil, ErrTranscriberClosed
+}
+func (t *stuckTranscriber) Terminate() error      { return nil }
+func (t *stuckTranscriber) ForceEndOfTurn() error { return nil }
+func (t *stuckTranscriber) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name  string
+		stuck bool
+		// the drain deadline and how long before it upstream is terminated
+		timeout         time.Duration
+		terminateBefore time.Duration
+		wantCause       error
+	}{
+		{
+			name:            "upstream flushes and the session ends",
+			timeout:         3 * time.Second,
+			terminateBefore: 2900 * time.Millisecond,
+			wantCause:       ErrUpstreamEnded,
+		},
+		{
+			name:            "session closed at the deadline",
+			stuck:           true,
+			timeout:         300 * time.Millisecond,
+			terminateBefore: 200 * time.Millisecond,
+			wantCause:       ErrServerDraining,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *Server
+			url, _ := startTestServer(t, func(s *Server) {
+				srv = s
+				s.Config.Drain.TerminateBefore = tt.terminateBefore
+				if tt.stuck {
+					s.NewTranscriber = func(ctx context.Context, language string) (Transcriber, error) {
+						return newStuckTranscriber(), nil
+					}
+				}
+			})
+			conn := dialSession(t, url)
+			session := readUntil(t, conn, SESSION_RESPONSE)
+			client := FindSession(session["sessionId"].(string))
+			waitFor(t, "session to be registered", func() bool { return countSessions() == 1 })
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			drained := make(chan struct{})
+			go func() {
+				srv.Drain(ctx)
+				close(drained)
+			}()
+
+			readUntil(t, conn, DRAINING_RESPONSE)
+			select {
+			case <-drained:
+			case <-time.After(tt.timeout + 5*time.Second):
+				t.Fatal("Drain did not return")
+			}
+			if n := countSessions(); n != 0 {
+				t.Errorf("%d sessions left after Drain", n)
+			}
+			if cause := client.Cause(); !errors.Is(cause, tt.wantCause) {
+				t.Errorf("session ended with %v, want %v", cause, tt.wantCause)
+			}
+
+			// new sessions are turned away
+			_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+			if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("dial while draining: %v, want %d", err, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// A session that doesn't leave the registry when it is closed must not keep Drain from returning.
+func TestDrainReturnsPastAStuckSession(t *testing.T) {
+	cfg := config.Default()
+	cfg.SupabaseJwtKey = "test-secret"
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zombie := NewClient(srv.Config, "zombie", nil, nopTranscriber{})
+	zombie.Close(ErrTerminated)
+	WaitForSaves()
+	sessions.Lock()
+	addSessionLocked(zombie)
+	sessions.Unlock()
+	t.Cleanup(func() { removeSession(zombie) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	drained := make(chan struct{})
+	go func() {
+		srv.Drain(ctx)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain kept waiting for a session that never leaves the registry")
+	}
+}
@@ -1,210 +1,208 @@
 package ws
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-func (c *Client) processClientAudio() {
+// processClientAudio reads audio from one browser connection.
+// A dropped connection detaches the client so it can resume, a normal close ends the session.
+func (c *Client) processClientAudio(ctx context.Context, conn *websocket.Conn) error {
 	errCount := 0
-	defer func() {
-		UnregisterClient(c)
-	}()
-
 	for {
-		select {
-		case <-c.Done:
-			c.Conn.Close()
-			return
-		default:
-
-			if errCount >= MaxErr {
-				log.Println("max err hit in read audio")
-				return
-			}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 
-			if c.Expired() {
-				c.Mu.Lock()
-				c.Conn.WriteJSON(map[string]any{
-					"type":    "error",
-					"message": "Your 30-minute session has expired",
-				})
-				c.Mu.Unlock()
-				return
-			}
+		if errCount >= c.cfg.Session.MaxErrors {
+			c.Logger.Warn("max err hit in read audio", "errors", errCount)
+			return fmt.Errorf("%w reading the browser connection", ErrTooManyErrors)
+		}
 
-			msgType, audio, err := c.Conn.ReadMessage()
-			if err != nil {
-				log.Println("err read message :", err)
-				continue
-			}
+		if c.Expired() {
+			c.send(NewStatusWriter(ERROR_RESPONSE, c.expiryMessage))
+			return ErrSessionExpired
+		}
 
-			if msgType != websocket.BinaryMessage {
-				log.Println("this is not a binary file")
-				errCount++
-				continue
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				// Close shut the connection
+				return context.Cause(ctx)
+			}
+			// the connection can't be read again after an error
+			c.Logger.Info("client connection read failed", "err", err)
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return ErrClientClosed
+			}
+			if !c.cfg.Features.Resume {
+				return fmt.Errorf("%w: %w", ErrClientLost, err)
 			}
+			c.detach(conn)
+			return nil
+		}
 
-			err = c.AssemblyConn.WriteMessage(websocket.BinaryMessage, audio)
-			if err != nil {
-				log.Println("err when sending audio to assembly", err)
+		if msgType == websocket.TextMessage {
+			if !c.handleControl(msg) {
+				countError("processClientAudio")
 				errCount++
-				continue
 			}
+			continue
 		}
 
+		if msgType != websocket.BinaryMessage {
+			c.Logger.Warn("unexpected websocket message type", "type", msgType)
+			countError("processClientAudio")
+			errCount++
+			continue
+		}
+		audioBytesIn.Add(float64(len(msg)))
+
+		if c.paused.Load() {
+			continue
+		}
+
+		audio := c.Audio.Convert(msg)
+		if len(audio) == 0 || !c.meterAudio(len(audio)) {
+			continue
+		}
+		c.audioBytes.Add(int64(len(audio)))
+		if c.Recorder != nil {
+			if err := c.Recorder.Write(audio); err != nil {
+				c.Logger.Error("failed to record audio", "err", err)
+			}
+		}
+		err = c.Transcriber.SendAudio(audio)
+		if err != nil {
+			c.Logger.Error("failed to send audio upstream", "err", err)
+			countError("processClientAudio")
+			errCount++
+			continue
+		}
+		c.lastAudioAt.Store(time.Now().UnixNano())
 	}
 }
 
-func (c *Client) processMsgTranscript() {
+func (c *Client) processMsgTranscript(ctx context.Context) error {
 	errCount := 0
-	defer func() {
-		UnregisterClient(c)
-	}()
 	for {
-		select {
-		case <-c.Done:
-			c.AssemblyConn.Close()
-			return
-		default:
-
-			if errCount >= MaxErr {
-				log.Println("max err hit in write message")
-				return
-			}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 
-			msgType, msg, err := c.AssemblyConn.ReadMessage()
-			if err != nil {
-				log.Println("AssemblyAI return an error:", err)
-				errCount++
-				continue
-			}
-			if msgType != websocket.TextMessage {
-				fmt.Println("from assembly, this is not a text message")
-				errCount++
-				continue
-			}
+		if errCount >= c.cfg.Session.MaxErrors {
+			c.Logger.Warn("max err hit in write message", "errors", errCount)
+			return fmt.Errorf("%w reading the transcriber", ErrTooManyErrors)
+		}
 
-			var parsed map[string]interface{}
-			err = json.Unmarshal(msg, &parsed)
-			if err != nil {
-				log.Println("cant parse json: ", err)
-				errCount++
-				continue
-			}
+		event, err := c.Transcriber.Receive()
+		if ctx.Err() != nil {
+			// Close shut the transcriber
+			return context.Cause(ctx)
+		}
+		if errors.Is(err, ErrTranscriberClosed) {
+			c.Logger.Info("transcriber closed", "err", err)
+			return err
+		}
+		if err != nil {
+			c.Logger.Error("transcriber returned an error", "err", err)
+			countError("processMsgTranscript")
+			errCount++
+			continue
+		}
 
-			if parsed["type"] == "Begin" {
-				c.Mu.Lock()
-				c.Conn.WriteMessage(websocket.TextMessage, []byte(`{"type" : "ready"}`))
-				log.Println("Got Begin:", string(msg))
-				c.Mu.Unlock()
-			}
-			if parsed["type"] == "Termination" {
-				log.Println("session end.")
-				return
+		switch event.Type {
+		case TRANSCRIPT_BEGIN:
+			c.setUpstreamState(UPSTREAM_STREAMING)
+			c.send(NewStatusWriter(READY_RESPONSE, ""))
+		case TRANSCRIPT_RECONNECTING:
+			c.upstreamDropped()
+		case TRANSCRIPT_RECONNECTED:
+			c.upstreamRecovered()
+		case TRANSCRIPT_TERMINATION:
+			c.Logger.Info("upstream session terminated")
+			return ErrUpstreamEnded
+		case TRANSCRIPT_TURN:
+			if sentAt := c.lastAudioAt.Load(); sentAt > 0 {
+				transcriptLatency.Observe(time.Since(time.Unix(0, sentAt)).Seconds())
 			}
-			if parsed["type"] == "Turn" {
-				log.Println("hello", len(msg), " length of bytes")
-
-				err = c.updateStateTranscript(msg)
-				if err != nil {
-					log.Println("err when update transcript: ", err)
-					return
-				}
-				log.Println("[INFOR] Recived ", len(msg), " length of bytes")
-
+			err = c.updateStateTranscript(event.Turn)
+			if err != nil {
+				c.Logger.Error("failed to update transcript", "err", err)
+				countError("processMsgTranscript")
+				return err
 			}
+			c.Logger.Debug("received turn", "turn_order", event.Turn.TurnOrder, "words", len(event.Turn.Words))
 		}
 	}
 }
 
-func (c *Client) readTranslate() {
-	defer func() {
-		UnregisterClient(c)
-	}()
+func (c *Client) readTranslate(ctx context.Context) error {
 	for {
-		select {
-		case <-c.Done:
-			c.AssemblyConn.Close()
-			return
-		default:
-			s := "Hello, this is a test translation. I will handle this later. "
-			arr := strings.Split(s, " ")
-			i := 0
-			for msg := range c.Transcript.CurrentWordsTranscript {
-				byteMsg, err := json.Marshal(msg)
-				if err != nil {
-					log.Println("err when encoding transcript word msg: ", err)
-					continue
-				}
-				log.Println("Infor: reading translate")
-
-				_ = byteMsg
-				// TODO: call translation api here
-				// For now just do a dummy translation
-				if i >= len(arr) {
-					i = 0
-				}
-				res := NewTranslateWriter(arr[i])
-				i++
-				log.Println("sending translate to chan")
-				c.TranslateWord <- res
-			}
+		turn, ok := c.translateIn.pop(ctx.Done())
+		if !ok {
+			return context.Cause(ctx)
+		}
+		targetLanguage := c.TargetLanguage()
+		if targetLanguage == "" {
+			continue
+		}
+
+		text := turn.Transcript
+		if text == "" {
+			text = joinWords(turn.Words)
+		}
+		if text == "" {
+			continue
+		}
+
+		translateCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		translated, err := c.Translator.Translate(translateCtx, text, c.Language(), targetLanguage)
+		cancel()
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if err != nil {
+			c.Logger.Error("failed to translate turn", "turn_order", turn.TurnOrder, "target_language", targetLanguage, "err", err)
+			countError("readTranslate")
+			continue
+		}
+
+		if !c.translateOut.push(NewTranslateWriter(turn.TurnOrder, targetLanguage, translated), ctx.Done()) {
+			return context.Cause(ctx)
 		}
 	}
 }
 
-func (c *Client) sendMsgTranscript() {
-	defer func() {
-		UnregisterClient(c)
-	}()
+func (c *Client) sendMsgTranscript(ctx context.Context) error {
 	for {
-		select {
-		case <-c.Done:
-			c.AssemblyConn.Close()
-			return
-		default:
-			for msg := range c.TranscriptWord {
-				byteMsg, err := json.Marshal(msg)
-				if err != nil {
-					log.Println("err when encoding transcript word msg: ", err)
-					continue
-				}
-				c.Mu.Lock()
-				c.Conn.WriteMessage(websocket.TextMessage, byteMsg)
-				c.Mu.Unlock()
-			}
+		msg, ok := c.transcriptOut.pop(ctx.Done())
+		if !ok {
+			return context.Cause(ctx)
 		}
+		if err := c.send(msg); err != nil {
+			c.Logger.Warn("failed to send transcript message", "err", err)
+			countError("sendMsgTranscript")
+		}
+		c.broadcastToRoom(ROOM_TRANSCRIPT, msg)
 	}
 }
 
-func (c *Client) sendMsgTranslate() {
-	defer func() {
-		UnregisterClient(c)
-	}()
+func (c *Client) sendMsgTranslate(ctx context.Context) error {
 	for {
-		select {
-		case <-c.Done:
-			c.AssemblyConn.Close()
-			return
-		default:
-			for msg := range c.TranslateWord {
-				byteMsg, err := json.Marshal(msg)
-				if err != nil {
-					log.Println("err when encoding translate word msg: ", err)
-					continue
-				}
-				c.Mu.Lock()
-				log.Println("Translate : ", string(byteMsg))
-				c.Conn.WriteMessage(websocket.TextMessage, byteMsg)
-				c.Mu.Unlock()
-			}
+		msg, ok := c.translateOut.pop(ctx.Done())
+		if !ok {
+			return context.Cause(ctx)
+		}
+		if err := c.send(msg); err != nil {
+			c.Logger.Warn("failed to send translate message", "err", err)
+			countError("sendMsgTranslate")
 		}
+		c.broadcastToRoom(ROOM_TRANSLATE, msg)
 	}
 }
 
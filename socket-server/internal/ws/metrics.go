@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"meetingmind-socket/internal/metrics"
+)
+
+var (
+	sessionDuration = metrics.NewHistogram("meetingmind_session_duration_seconds",
+		"How long live sessions lasted.", []float64{10, 30, 60, 300, 600, 900, 1200, 1800, 3600})
+	audioBytesIn = metrics.NewCounter("meetingmind_audio_bytes_in_total",
+		"Audio bytes received from browsers, before conversion.")
+	upstreamMessages = metrics.NewCounterVec("meetingmind_upstream_messages_sent_total",
+		"Messages sent to the transcription provider.", "type")
+	upstreamConnectFailures = metrics.NewCounterVec("meetingmind_upstream_connect_failures_total",
+		"Failed attempts to open a transcription stream.", "stage")
+	transcriptLatency = metrics.NewHistogram("meetingmind_transcript_latency_seconds",
+		"Time between the last audio sent upstream and the transcript turn it produced.", metrics.DefBuckets)
+	goroutineErrors = metrics.NewCounterVec("meetingmind_goroutine_errors_total",
+		"Errors seen by each per-session goroutine.", "goroutine")
+	upstreamReconnects = metrics.NewCounterVec("meetingmind_upstream_reconnects_total",
+		"Attempts to replace a dropped transcription stream, by result.", "result")
+	upstreamAudioDropped = metrics.NewCounter("meetingmind_upstream_audio_dropped_bytes_total",
+		"Audio dropped because it didn't fit the buffer while the transcription stream reconnected.")
+	tokenFetchLatency = metrics.NewHistogram("meetingmind_token_fetch_seconds",
+		"Latency of minting a streaming token.", metrics.DefBuckets)
+	queueDepth = metrics.NewGaugeVec("meetingmind_ws_queue_depth",
+		"Messages waiting in the per-session queues.", "stream")
+	queueCoalesced = metrics.NewCounterVec("meetingmind_ws_queue_coalesced_total",
+		"Partial transcripts folded into a queued one.", "stream")
+	queueDropped = metrics.NewCounterVec("meetingmind_ws_queue_dropped_total",
+		"Partial transcripts without final words dropped from a full queue.", "stream")
+	slowConsumers = metrics.NewCounterVec("meetingmind_ws_slow_consumers_total",
+		"Times a queue filled up with messages that can't be dropped, the browser connection is dropped for browser streams.", "stream")
+)
+
+func init() {
+	metrics.NewGaugeFunc("meetingmind_active_sessions", "Live sessions, including detached ones waiting to resume.",
+		func() float64 { return float64(countSessions()) })
+	metrics.NewGaugeFunc("meetingmind_rooms", "Open rooms.", func() float64 {
+		rooms.Lock()
+		defer rooms.Unlock()
+		return float64(len(rooms.byId))
+	})
+}
+
+// countError counts an error of one of the session goroutines.
+func countError(goroutine string) {
+	goroutineErrors.With(goroutine).Inc()
+}
@@ -1,20 +1,56 @@
 package ws
 
-var MaxErr = 10
-
 type RESPONSE_TYPE string
 
 const (
 	TRANSCRIPT_RESPONSE RESPONSE_TYPE = "transcript"
 	TRANSLATE_RESPONSE  RESPONSE_TYPE = "translate"
+	READY_RESPONSE      RESPONSE_TYPE = "ready"
+	ERROR_RESPONSE      RESPONSE_TYPE = "error"
+	SESSION_RESPONSE    RESPONSE_TYPE = "session"
+	DRAINING_RESPONSE   RESPONSE_TYPE = "draining"
+	TAKEN_OVER_RESPONSE RESPONSE_TYPE = "taken_over"
+	// transcription is paused while the upstream connection is reopened, then resumes
+	DEGRADED_RESPONSE  RESPONSE_TYPE = "degraded"
+	RECOVERED_RESPONSE RESPONSE_TYPE = "recovered"
 )
 
+// Sequenced is embedded in every message sent to the browser,
+// a resuming client passes the last seq it got to receive what it missed.
+type Sequenced struct {
+	Seq int64 `json:"seq"`
+}
+
+func (s *Sequenced) setSeq(seq int64) {
+	s.Seq = seq
+}
+
+type sequencedMessage interface {
+	setSeq(seq int64)
+}
+
+type StatusWriter struct {
+	Sequenced
+	Type      RESPONSE_TYPE `json:"type"`
+	Message   string        `json:"message,omitempty"`
+	SessionId string        `json:"sessionId,omitempty"`
+}
+
+func NewStatusWriter(responseType RESPONSE_TYPE, message string) *StatusWriter {
+	return &StatusWriter{
+		Type:    responseType,
+		Message: message,
+	}
+}
+
 type AssemblyResponseWord struct {
 	Start       int     `json:"start"`
 	End         int     `json:"end"`
 	Text        string  `json:"text"`
 	Confidence  float64 `json:"confidence"`
 	WordIsFinal bool    `json:"word_is_final"`
+	// diarization label, e.g. "A"
+	Speaker string `json:"speaker,omitempty"`
 }
 
 type AssemblyRessponseTurn struct {
@@ -23,6 +59,6 @@ type AssemblyRessponseTurn struct {
 	EndOfTurn           bool                   `json:"end_of_turn"`
 	EndOfTurnConfidence float64                `json:"end_of_turn_confidence"`
 	Words               []AssemblyResponseWord `json:"words"`
+	SpeakerLabel        string                 `json:"speaker_label,omitempty"`
 	Type                string                 `json:"type"`
 }
-
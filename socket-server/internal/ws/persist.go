@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"meetingmind-socket/internal/models"
+	"meetingmind-socket/internal/service"
+	"strings"
+	"sync"
+)
+
+var pendingSaves sync.WaitGroup
+
+// SessionSaver stores a finished session in the user's history.
+type SessionSaver func(ctx context.Context, session service.LiveSession) (models.AudioFile, error)
+
+// saveSession uploads the recording and writes the session transcript to the user's history,
+// it returns the id of the audio file or an empty string. Sessions without any final word are not saved.
+func (c *Client) saveSession() string {
+	session, ok := c.liveSession()
+	if !ok {
+		c.Logger.Info("nothing to save for session")
+		if c.Recorder != nil {
+			c.Recorder.Discard()
+		}
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Session.SaveTimeout)
+	defer cancel()
+
+	if c.Recorder != nil {
+		recordingPath := fmt.Sprintf("recordings/%s/%s.wav", c.UserId, c.SessionId)
+		size, err := c.Recorder.Finish(ctx, recordingPath)
+		if err != nil {
+			c.Logger.Error("failed to upload recording", "path", recordingPath, "err", err)
+			countError("saveSession")
+		} else {
+			session.Path = recordingPath
+			session.FileSize = size
+			session.MimeType = RECORDING_MIME_TYPE
+		}
+	}
+
+	audio, err := c.saveSessionFn(ctx, session)
+	if err != nil {
+		c.Logger.Error("failed to save live session", "err", err)
+		countError("saveSession")
+		return ""
+	}
+	c.Logger.Info("saved live session", "audio_id", audio.ID, "words", len(session.Words))
+	return audio.ID.String()
+}
+
+// liveSession is what goes into the user's history. Path stays empty unless a recording is uploaded,
+// the web app shows no player for such a row.
+func (c *Client) liveSession() (service.LiveSession, bool) {
+	turns := c.Transcript.FinishedTurns()
+
+	texts := make([]string, 0, len(turns))
+	words := make([]models.TranscriptionWord, 0)
+	speakers := make(map[string]bool)
+	confidenceSum := 0.0
+	for _, turn := range turns {
+		text := turn.Transcript
+		if text == "" {
+			text = joinWords(turn.Words)
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+		for _, w := range turn.Words {
+			if !w.WordIsFinal {
+				continue
+			}
+			word := models.TranscriptionWord{
+				Text:        w.Text,
+				Confidence:  w.Confidence,
+				StartTime:   float64(w.Start),
+				EndTime:     float64(w.End),
+				WordIsFinal: true,
+			}
+			if w.Speaker != "" {
+				speakers[w.Speaker] = true
+				// names given during the session apply to all of it
+				name := c.Transcript.SpeakerName(w.Speaker)
+				word.Speaker = &name
+			}
+			words = append(words, word)
+			confidenceSum += w.Confidence
+		}
+	}
+	if len(words) == 0 {
+		return service.LiveSession{}, false
+	}
+
+	// numeric(3,2) in the transcripts table
+	confidence := math.Round(confidenceSum/float64(len(words))*100) / 100
+
+	return service.LiveSession{
+		UserId:          c.UserId,
+		Name:            "Live meeting " + c.StartTime.UTC().Format("2006-01-02 15:04"),
+		DurationSeconds: c.meteredSeconds(),
+		Text:            strings.Join(texts, " "),
+		Language:        c.Language(),
+		Confidence:      &confidence,
+		Speakers:        max(len(speakers), 1),
+		Words:           words,
+	}, true
+}
+
+// WaitForSaves blocks until every session that already ended is persisted.
+// Each save is bounded by SaveSessionTimeout.
+func WaitForSaves() {
+	pendingSaves.Wait()
+}
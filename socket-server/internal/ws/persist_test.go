@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLiveSession(t *testing.T) {
+	c := &Client{
+		UserId:     "test-user",
+		StartTime:  time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC),
+		Transcript: NewTranscriptState(),
+		language:   "en",
+	}
+	if _, ok := c.liveSession(); ok {
+		t.Fatal("session without a final word would be saved")
+	}
+
+	c.Transcript.recordTurn(&TranscriptTurn{TurnOrder: 0, Transcript: "hello world", EndOfTurn: true, Speaker: "A", Words: []AssemblyResponseWord{
+		{Start: 0, End: 400, Text: "hello", Confidence: 0.91, WordIsFinal: true, Speaker: "A"},
+		{Start: 400, End: 900, Text: "world", Confidence: 0.88, WordIsFinal: true, Speaker: "A"},
+	}})
+	// the session stopped mid turn, its final words are kept
+	c.Transcript.recordTurn(&TranscriptTurn{TurnOrder: 1, Speaker: "B", Words: []AssemblyResponseWord{
+		{Start: 1200, End: 1500, Text: "this", Confidence: 0.706, WordIsFinal: true, Speaker: "B"},
+		{Start: 1500, End: 1700, Text: "is", Confidence: 0.2, Speaker: "B"},
+	}})
+	c.Transcript.SetSpeakerName("B", "Dana")
+	// a second and a half of audio
+	c.audioBytes.Store(AUDIO_BYTES_PER_SECOND * 3 / 2)
+
+	session, ok := c.liveSession()
+	if !ok {
+		t.Fatal("session with final words not saved")
+	}
+	if session.Text != "hello world this" {
+		t.Errorf("text %q", session.Text)
+	}
+	if session.Path != "" {
+		t.Errorf("path %q without a recording, want none", session.Path)
+	}
+	if session.Name != "Live meeting 2026-10-18 09:30" || session.UserId != "test-user" || session.Language != "en" {
+		t.Errorf("session %+v", session)
+	}
+	if session.DurationSeconds != 2 {
+		t.Errorf("duration %ds, want the second and a half rounded up", session.DurationSeconds)
+	}
+	// (0.91 + 0.88 + 0.706) / 3 = 0.8320, numeric(3,2)
+	if session.Confidence == nil || *session.Confidence != 0.83 {
+		t.Errorf("confidence %v, want 0.83", session.Confidence)
+	}
+	if session.Speakers != 2 {
+		t.Errorf("%d speakers, want 2", session.Speakers)
+	}
+
+	wantWords := []struct{ text, speaker string }{{"hello", "A"}, {"world", "A"}, {"this", "Dana"}}
+	if len(session.Words) != len(wantWords) {
+		t.Fatalf("saved %d words, want the %d final ones", len(session.Words), len(wantWords))
+	}
+	for i, want := range wantWords {
+		w := session.Words[i]
+		if w.Text != want.text || w.Speaker == nil || *w.Speaker != want.speaker || !w.WordIsFinal {
+			t.Errorf("word %d = %+v, want %q by %q", i, w, want.text, want.speaker)
+		}
+	}
+	if session.Words[2].StartTime != 1200 || session.Words[2].EndTime != 1500 {
+		t.Errorf("word times %v-%v, want 1200-1500", session.Words[2].StartTime, session.Words[2].EndTime)
+	}
+}
@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"meetingmind-socket/internal/service"
+	"strings"
+	"time"
+)
+
+const PLAN_RESPONSE RESPONSE_TYPE = "plan"
+
+const entitlementLookupTimeout = 5 * time.Second
+
+// EntitlementLookup finds the plan and monthly usage of a connecting user.
+type EntitlementLookup func(ctx context.Context, userId string, now time.Time) (service.Entitlement, error)
+
+// PlanWriter tells the browser which limits apply to the session, Message explains a downgrade.
+type PlanWriter struct {
+	Sequenced
+	Type                  RESPONSE_TYPE    `json:"type"`
+	Plan                  service.PLAN_KEY `json:"plan"`
+	Status                string           `json:"status,omitempty"`
+	MaxSessionSeconds     int              `json:"maxSessionSeconds"`
+	MaxConcurrentSessions int              `json:"maxConcurrentSessions"`
+	Translation           bool             `json:"translation"`
+	RemainingMinutes      int64            `json:"remainingMinutes"`
+	ExpiresAt             time.Time        `json:"expiresAt"`
+	Message               string           `json:"message,omitempty"`
+}
+
+// entitlementFor decides the plan of a connecting user.
+// A non empty refusal is the reason they can't start a session.
+func (s *Server) entitlementFor(userId string) (service.Entitlement, string) {
+	if !s.Config.Billing.Enforce {
+		return service.Entitlement{
+			Plan:        service.Plans[service.PLAN_PRO],
+			PeriodStart: service.UsagePeriodStart(time.Now()),
+		}, ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), entitlementLookupTimeout)
+	defer cancel()
+	entitlement, err := s.LookupEntitlement(ctx, userId, time.Now())
+	if err != nil {
+		// don't lock everyone out while the database is down, the free plan is the safe guess
+		slog.Warn("failed to look up the plan, applying the free plan", "user_id", userId, "err", err)
+		entitlement = service.Entitlement{
+			Plan:        service.Plans[service.PLAN_FREE],
+			PeriodStart: service.UsagePeriodStart(time.Now()),
+		}
+	}
+
+	if entitlement.Status == service.SUBSCRIPTION_PAST_DUE && s.Config.Billing.PastDuePolicy == "refuse" {
+		return entitlement, "Your payment is past due, please update your billing details to start a live session"
+	}
+	if remainingSeconds(userId, entitlement) <= 0 {
+		return entitlement, fmt.Sprintf("You have used all %d hours of transcription of your %s plan this month",
+			entitlement.Plan.MonthlySeconds/3600, entitlement.Plan.Key)
+	}
+	// checked again when the session is admitted, this spares opening an upstream stream for nothing
+	if !s.takesOver() && countActiveSessions(userId) >= s.sessionLimit(entitlement) {
+		return entitlement, s.limitRefusal(entitlement)
+	}
+	return entitlement, ""
+}
+
+// sessionLimit is how many sessions the user may run at a time, the plan's number capped by the config.
+func (s *Server) sessionLimit(entitlement service.Entitlement) int {
+	limit := entitlement.Plan.MaxConcurrentSessions
+	if s.Config.Session.MaxConcurrent > 0 {
+		limit = min(limit, s.Config.Session.MaxConcurrent)
+	}
+	return limit
+}
+
+func (s *Server) takesOver() bool {
+	return s.Config.Session.ConcurrentPolicy == "takeover"
+}
+
+func (s *Server) limitRefusal(entitlement service.Entitlement) string {
+	return fmt.Sprintf("Your %s plan allows %d live session(s) at a time, please end another session first",
+		entitlement.Plan.Key, s.sessionLimit(entitlement))
+}
+
+// remainingSeconds is the quota left to a connecting user, the meter of their running sessions
+// knows better than the ledger which only counts ended ones.
+func remainingSeconds(userId string, entitlement service.Entitlement) int64 {
+	meters.Lock()
+	defer meters.Unlock()
+	if m := meters.byUser[userId]; m != nil {
+		return m.remainingSeconds()
+	}
+	return entitlement.RemainingSeconds()
+}
+
+// applyEntitlement limits the session to the plan and the server config,
+// and meters its audio against the minutes left this month.
+func (c *Client) applyEntitlement(entitlement service.Entitlement) {
+	c.Entitlement = entitlement
+
+	length := min(c.cfg.Session.MaxLength, entitlement.Plan.MaxSessionLength)
+	c.expiryMessage = fmt.Sprintf("Your %d-minute session has expired", int(length.Minutes()))
+	c.ExpiresAt = c.StartTime.Add(length)
+	if c.cfg.Billing.Enforce {
+		c.meter = joinMeter(c.UserId, entitlement.RemainingSeconds())
+	}
+
+	if !entitlement.Plan.Translation {
+		c.SetTargetLanguage("")
+	}
+}
+
+func (c *Client) planMessage() *PlanWriter {
+	msg := &PlanWriter{
+		Type:                  PLAN_RESPONSE,
+		Plan:                  c.Entitlement.Plan.Key,
+		Status:                string(c.Entitlement.Status),
+		MaxSessionSeconds:     int(c.ExpiresAt.Sub(c.StartTime).Seconds()),
+		MaxConcurrentSessions: c.maxSessions,
+		Translation:           c.Entitlement.Plan.Translation && c.canTranslate(),
+		RemainingMinutes:      c.Entitlement.RemainingSeconds() / 60,
+		ExpiresAt:             c.ExpiresAt,
+	}
+	if c.meter != nil {
+		msg.RemainingMinutes = c.meter.remainingSeconds() / 60
+	}
+	if c.Entitlement.Downgraded {
+		status := strings.ReplaceAll(string(c.Entitlement.Status), "_", " ")
+		msg.Message = fmt.Sprintf("Your subscription is %s, the free plan limits apply", status)
+		if c.Entitlement.Status == service.SUBSCRIPTION_PAST_DUE {
+			msg.Message += " until the payment goes through"
+		}
+	}
+	return msg
+}
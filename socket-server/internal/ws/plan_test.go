@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// entitlementOf builds what the database would answer for a user with that subscription.
+func entitlementOf(status service.SUBSCRIPTION_STATUS, usedSeconds int64) service.Entitlement {
+	plan, downgraded := service.PlanForStatus(status)
+	return service.Entitlement{
+		Plan:        plan,
+		Status:      status,
+		Downgraded:  downgraded,
+		PeriodStart: service.UsagePeriodStart(time.Now()),
+		UsedSeconds: usedSeconds,
+	}
+}
+
+func TestEntitlementFor(t *testing.T) {
+	tests := []struct {
+		name          string
+		enforce       bool
+		pastDue       string
+		entitlement   service.Entitlement
+		lookupErr     error
+		wantPlan      service.PLAN_KEY
+		wantRefusal   string
+		wantNoLookups bool
+	}{
+		{name: "billing not enforced", wantPlan: service.PLAN_PRO, wantNoLookups: true},
+		{name: "active subscription", enforce: true, entitlement: entitlementOf(service.SUBSCRIPTION_ACTIVE, 0), wantPlan: service.PLAN_PRO},
+		{name: "trialing subscription", enforce: true, entitlement: entitlementOf(service.SUBSCRIPTION_TRIALING, 0), wantPlan: service.PLAN_PRO},
+		{name: "no subscription", enforce: true, entitlement: entitlementOf("", 0), wantPlan: service.PLAN_FREE},
+		{
+			name:        "past due downgraded",
+			enforce:     true,
+			pastDue:     "downgrade",
+			entitlement: entitlementOf(service.SUBSCRIPTION_PAST_DUE, 0),
+			wantPlan:    service.PLAN_FREE,
+		},
+		{
+			name:        "past due refused",
+			enforce:     true,
+			pastDue:     "refuse",
+			entitlement: entitlementOf(service.SUBSCRIPTION_PAST_DUE, 0),
+			wantPlan:    service.PLAN_FREE,
+			wantRefusal: "payment is past due",
+		},
+		{
+			name:        "monthly quota used",
+			enforce:     true,
+			entitlement: entitlementOf("", service.Plans[service.PLAN_FREE].MonthlySeconds),
+			wantPlan:    service.PLAN_FREE,
+			wantRefusal: "used all 3 hours of transcription of your FREE plan",
+		},
+		{
+			name:        "pro quota used",
+			enforce:     true,
+			entitlement: entitlementOf(service.SUBSCRIPTION_ACTIVE, service.Plans[service.PLAN_PRO].MonthlySeconds+60),
+			wantPlan:    service.PLAN_PRO,
+			wantRefusal: "used all 50 hours",
+		},
+		{name: "database down", enforce: true, lookupErr: errors.New("connection refused"), wantPlan: service.PLAN_FREE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Billing.Enforce = tt.enforce
+			if tt.pastDue != "" {
+				cfg.Billing.PastDuePolicy = tt.pastDue
+			}
+			lookups := 0
+			s := &Server{Config: cfg, LookupEntitlement: func(ctx context.Context, userId string, now time.Time) (service.Entitlement, error) {
+				lookups++
+				return tt.entitlement, tt.lookupErr
+			}}
+
+			entitlement, refusal := s.entitlementFor("plan-user")
+			if entitlement.Plan.Key != tt.wantPlan {
+				t.Errorf("plan %s, want %s", entitlement.Plan.Key, tt.wantPlan)
+			}
+			if tt.wantRefusal == "" && refusal != "" || !strings.Contains(refusal, tt.wantRefusal) {
+				t.Errorf("refusal %q, want %q", refusal, tt.wantRefusal)
+			}
+			if tt.wantNoLookups && lookups > 0 {
+				t.Errorf("looked up the plan %d times with billing off", lookups)
+			}
+		})
+	}
+}
+
+func TestPlanReachesTheBrowser(t *testing.T) {
+	t.Run("downgraded plan", func(t *testing.T) {
+		url, _ := startTestServer(t, func(s *Server) {
+			s.LookupEntitlement = func(ctx context.Context, userId string, now time.Time) (service.Entitlement, error) {
+				return entitlementOf(service.SUBSCRIPTION_PAST_DUE, 30*60), nil
+			}
+		})
+		conn := dialSession(t, url)
+		plan := readUntil(t, conn, PLAN_RESPONSE)
+		if plan["plan"] != string(service.PLAN_FREE) || plan["remainingMinutes"] != float64(150) ||
+			!strings.Contains(plan["message"].(string), "past due") {
+			t.Errorf("plan message %v", plan)
+		}
+	})
+
+	t.Run("refused session", func(t *testing.T) {
+		url, _ := startTestServer(t, func(s *Server) {
+			s.Config.Billing.PastDuePolicy = "refuse"
+			s.LookupEntitlement = func(ctx context.Context, userId string, now time.Time) (service.Entitlement, error) {
+				return entitlementOf(service.SUBSCRIPTION_PAST_DUE, 0), nil
+			}
+		})
+		conn := dialSession(t, url)
+		msg := readUntil(t, conn, ERROR_RESPONSE)
+		if !strings.Contains(msg["message"].(string), "past due") {
+			t.Errorf("refusal %v", msg)
+		}
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("connection after the refusal: %v, want a policy violation close", err)
+		}
+		if n := countSessions(); n != 0 {
+			t.Errorf("%d sessions registered for a refused user", n)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package ws
+
+import (
+	"slices"
+	"sync"
+)
+
+// Streams of the per-session queues, used as the metrics label.
+const (
+	STREAM_TRANSCRIPT      = "transcript"
+	STREAM_TRANSLATE       = "translate"
+	STREAM_TRANSLATE_INPUT = "translate_input"
+)
+
+// queue sits between one producer and one consumer goroutine of a session. It holds at most
+// capacity items: once full, the oldest droppable item makes room, or the new one is dropped if
+// it is droppable itself. Other items, like finished turns, are never dropped, the producer waits
+// for the consumer instead and full is called. merge lets a new item fold into the last queued one.
+type queue[T any] struct {
+	stream    string
+	capacity  int
+	merge     func(queued T, next T) (T, bool)
+	droppable func(item T) bool
+	// called when the producer starts waiting for the consumer
+	full func()
+
+	mu    sync.Mutex
+	items []T
+	ready chan struct{}
+	space chan struct{}
+}
+
+func newQueue[T any](stream string, capacity int) *queue[T] {
+	return &queue[T]{
+		stream:   stream,
+		capacity: capacity,
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+}
+
+// push queues the item, it only waits while the queue is full of items that can't be dropped.
+// It returns false when done is closed first, the item goes away with the session then.
+func (q *queue[T]) push(item T, done <-chan struct{}) bool {
+	waiting := false
+	for {
+		q.mu.Lock()
+		if n := len(q.items); n > 0 && q.merge != nil {
+			if merged, ok := q.merge(q.items[n-1], item); ok {
+				q.items[n-1] = merged
+				q.mu.Unlock()
+				queueCoalesced.With(q.stream).Inc()
+				return true
+			}
+		}
+		if len(q.items) < q.capacity || q.dropOldestLocked() {
+			q.items = append(q.items, item)
+			q.mu.Unlock()
+			queueDepth.With(q.stream).Inc()
+			signal(q.ready)
+			return true
+		}
+		q.mu.Unlock()
+
+		if q.droppable != nil && q.droppable(item) {
+			queueDropped.With(q.stream).Inc()
+			return true
+		}
+		if !waiting {
+			waiting = true
+			if q.full != nil {
+				q.full()
+			}
+		}
+		select {
+		case <-q.space:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// dropOldestLocked makes room by dropping the oldest droppable item, it returns false without one.
+func (q *queue[T]) dropOldestLocked() bool {
+	if q.droppable == nil {
+		return false
+	}
+	i := slices.IndexFunc(q.items, q.droppable)
+	if i < 0 {
+		return false
+	}
+	q.items = slices.Delete(q.items, i, i+1)
+	queueDropped.With(q.stream).Inc()
+	queueDepth.With(q.stream).Dec()
+	return true
+}
+
+// pop waits for the oldest item, it returns false once done is closed.
+func (q *queue[T]) pop(done <-chan struct{}) (T, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			var zero T
+			q.items[0] = zero
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			queueDepth.With(q.stream).Dec()
+			signal(q.space)
+			return item, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-done:
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// discard drops what is still waiting once the session ended.
+func (q *queue[T]) discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queueDepth.With(q.stream).Add(-float64(len(q.items)))
+	q.items = nil
+}
+
+// droppablePartial tells whether a transcript message can be dropped from a full queue:
+// partials without final words, the next message of the turn supersedes them.
+func droppablePartial(msg *TranscriptWriter) bool {
+	if msg.IsEndOfTurn {
+		return false
+	}
+	return !slices.ContainsFunc(msg.Words, func(w AssemblyResponseWord) bool { return w.WordIsFinal })
+}
+
+// mergePartials folds two partial messages of the same turn into one. The final words of the
+// queued message are kept, its other words are superseded by the next message.
+func mergePartials(queued *TranscriptWriter, next *TranscriptWriter) (*TranscriptWriter, bool) {
+	if queued.IsEndOfTurn || next.IsEndOfTurn || queued.turnOrder != next.turnOrder {
+		return nil, false
+	}
+	words := make([]AssemblyResponseWord, 0, len(queued.Words)+len(next.Words))
+	for _, w := range queued.Words {
+		if w.WordIsFinal {
+			words = append(words, w)
+		}
+	}
+	merged := *next
+	merged.Words = append(words, next.Words...)
+	return &merged, true
+}
+
+// slowConsumer drops the browser connection of a session whose queue is full. With resume the
+// session waits detached and the browser gets what it missed from the replay buffer on reattach.
+func (c *Client) slowConsumer(stream string) {
+	if !c.slow.CompareAndSwap(false, true) {
+		return
+	}
+	slowConsumers.With(stream).Inc()
+	c.Logger.Warn("browser can't keep up, dropping its connection", "stream", stream,
+		"transcript_queue", c.transcriptOut.len(), "translate_queue", c.translateOut.len())
+	// the writer may hold Mu until its write deadline, the producer doesn't wait for it
+	go func() {
+		c.Mu.Lock()
+		conn := c.Conn
+		c.Mu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+}
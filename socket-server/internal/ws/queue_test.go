@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func partial(turnOrder int, final bool) *TranscriptWriter {
+	msg := NewTranscriptWriter(false, []AssemblyResponseWord{{Text: "word", WordIsFinal: final}})
+	msg.turnOrder = turnOrder
+	return msg
+}
+
+func endOfTurn(turnOrder int) *TranscriptWriter {
+	msg := NewTranscriptWriter(true, []AssemblyResponseWord{{Text: "word", WordIsFinal: true}})
+	msg.turnOrder = turnOrder
+	return msg
+}
+
+func newTranscriptQueue(capacity int) *queue[*TranscriptWriter] {
+	q := newQueue[*TranscriptWriter](STREAM_TRANSCRIPT, capacity)
+	q.droppable = droppablePartial
+	return q
+}
+
+func TestQueueDropsOnlyPartialsWithoutFinalWords(t *testing.T) {
+	q := newTranscriptQueue(2)
+	done := make(chan struct{})
+	defer q.discard()
+
+	q.push(partial(0, false), done)
+	q.push(endOfTurn(0), done)
+	// full: the queued partial makes room
+	q.push(endOfTurn(1), done)
+	// full of finished turns: the new partial is dropped
+	q.push(partial(2, false), done)
+
+	if n := q.len(); n != 2 {
+		t.Fatalf("queue holds %d items, want its capacity 2", n)
+	}
+	for _, want := range []int{0, 1} {
+		msg, _ := q.pop(done)
+		if !msg.IsEndOfTurn || msg.turnOrder != want {
+			t.Errorf("popped turn %d (end of turn %v), want the end of turn %d", msg.turnOrder, msg.IsEndOfTurn, want)
+		}
+	}
+}
+
+func TestQueueWaitsInsteadOfDroppingFinishedTurns(t *testing.T) {
+	q := newTranscriptQueue(1)
+	full := make(chan struct{}, 1)
+	q.full = func() { full <- struct{}{} }
+	done := make(chan struct{})
+	defer q.discard()
+
+	q.push(endOfTurn(0), done)
+	pushed := make(chan bool)
+	go func() { pushed <- q.push(partial(1, true), done) }()
+
+	select {
+	case <-full:
+	case <-time.After(time.Second):
+		t.Fatal("full wasn't called for a queue full of finished turns")
+	}
+	select {
+	case <-pushed:
+		t.Fatal("push returned while the queue was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.pop(done)
+	if !<-pushed {
+		t.Fatal("push failed once there was room")
+	}
+	if msg, _ := q.pop(done); msg.turnOrder != 1 {
+		t.Errorf("popped turn %d, want the partial with final words of turn 1", msg.turnOrder)
+	}
+
+	q.push(endOfTurn(2), done)
+	go func() { pushed <- q.push(endOfTurn(3), done) }()
+	<-full
+	close(done)
+	if <-pushed {
+		t.Error("push reported success after the session ended")
+	}
+}
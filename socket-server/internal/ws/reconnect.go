@@ -0,0 +1,300 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"meetingmind-socket/internal/config"
+	"sync"
+	"time"
+)
+
+var (
+	errReconnecting = errors.New("upstream is reconnecting")
+	errTerminating  = errors.New("upstream is terminating")
+)
+
+// ReconnectingTranscriber keeps one transcription stream going across provider connections.
+// When a connection drops Receive reports TRANSCRIPT_RECONNECTING and opens a new one with
+// backoff, each with a freshly minted token. Audio sent meanwhile is buffered and replayed on
+// the new connection, whose word timestamps and turn orders continue where the old one stopped.
+// Switching to a language of another speech model goes through the same path.
+type ReconnectingTranscriber struct {
+	dial   TranscriberFactory
+	cfg    config.UpstreamConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// nil from a drop until the next connection is open
+	current Transcriber
+	// spoken language the next connection is opened with
+	language string
+	// the current connection was retired for a language switch
+	switching bool
+	// the next Begin is reported as TRANSCRIPT_RECONNECTED
+	resumed     bool
+	terminating bool
+	buffer      [][]byte
+	bufferBytes int
+	// audio sent on the current connection, and before it, sent or dropped
+	sentBytes   int64
+	offsetBytes int64
+	// turn orders restart at 0 on every connection
+	turnOffset int
+	nextTurn   int
+}
+
+// NewReconnectingTranscriber opens the first connection, retrying like a reconnect.
+func NewReconnectingTranscriber(ctx context.Context, cfg config.UpstreamConfig, language string, dial TranscriberFactory) (*ReconnectingTranscriber, error) {
+	r := &ReconnectingTranscriber{dial: dial, cfg: cfg, language: language}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, r.cancel)
+
+	current, err := r.connect()
+	if !stop() && err == nil {
+		// ctx ended right as the connection opened
+		current.Close()
+		err = fmt.Errorf("%w: %w", ErrTranscriberClosed, ctx.Err())
+	}
+	if err != nil {
+		r.cancel()
+		return nil, err
+	}
+	r.current = current
+	return r, nil
+}
+
+// connect dials until a connection opens, the attempts are used up or Close is called.
+func (r *ReconnectingTranscriber) connect() (Transcriber, error) {
+	backoff := r.cfg.ReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		r.mu.Lock()
+		language := r.language
+		r.mu.Unlock()
+		t, err := r.dial(r.ctx, language)
+		if err == nil {
+			return t, nil
+		}
+		if r.ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: closed while connecting", ErrTranscriberClosed)
+		}
+		if attempt > r.cfg.ReconnectAttempts {
+			return nil, fmt.Errorf("%w: gave up after %d attempts: %w", ErrTranscriberClosed, attempt, err)
+		}
+
+		wait := backoff + rand.N(backoff/4+1)
+		slog.Warn("upstream connect failed, retrying", "attempt", attempt, "retry_in", wait, "err", err)
+		select {
+		case <-time.After(wait):
+		case <-r.ctx.Done():
+			return nil, fmt.Errorf("%w: closed while connecting", ErrTranscriberClosed)
+		}
+		backoff = min(backoff*2, r.cfg.ReconnectMaxBackoff)
+	}
+}
+
+func (r *ReconnectingTranscriber) SendAudio(audio []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return ErrTranscriberClosed
+	}
+	if r.current == nil {
+		r.bufferLocked(audio)
+		return nil
+	}
+	if err := r.current.SendAudio(audio); err != nil {
+		if r.terminating {
+			return err
+		}
+		// Receive sees the closed connection and reports the drop
+		slog.Warn("failed to send audio upstream, reconnecting", "err", err)
+		r.retireLocked()
+		r.bufferLocked(audio)
+		return nil
+	}
+	r.sentBytes += int64(len(audio))
+	return nil
+}
+
+// bufferLocked keeps audio for the next connection, the oldest is dropped past ReconnectBuffer.
+// Dropped audio still moves the timeline so later words keep their place.
+func (r *ReconnectingTranscriber) bufferLocked(audio []byte) {
+	r.buffer = append(r.buffer, append([]byte(nil), audio...))
+	r.bufferBytes += len(audio)
+	limit := int(r.cfg.ReconnectBuffer.Seconds() * AUDIO_BYTES_PER_SECOND)
+	for r.bufferBytes > limit && len(r.buffer) > 0 {
+		dropped := len(r.buffer[0])
+		r.buffer = r.buffer[1:]
+		r.bufferBytes -= dropped
+		r.offsetBytes += int64(dropped)
+		upstreamAudioDropped.Add(float64(dropped))
+	}
+}
+
+// retireLocked closes the current connection and moves the timeline past what it was sent.
+func (r *ReconnectingTranscriber) retireLocked() {
+	r.current.Close()
+	r.current = nil
+	r.offsetBytes += r.sentBytes
+	r.sentBytes = 0
+	r.turnOffset = r.nextTurn
+}
+
+func (r *ReconnectingTranscriber) Receive() (*TranscriptEvent, error) {
+	for {
+		r.mu.Lock()
+		current := r.current
+		r.mu.Unlock()
+
+		if current == nil {
+			if err := r.reconnect(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		event, err := current.Receive()
+		if err == nil {
+			return r.adjust(event), nil
+		}
+		if !errors.Is(err, ErrTranscriberClosed) || !r.dropped(current) {
+			return nil, err
+		}
+		slog.Warn("upstream connection dropped", "err", err)
+		return &TranscriptEvent{Type: TRANSCRIPT_RECONNECTING}, nil
+	}
+}
+
+// dropped tells whether a closed connection should be replaced, not after Close or Terminate.
+func (r *ReconnectingTranscriber) dropped(t Transcriber) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil || r.terminating {
+		return false
+	}
+	if r.cfg.ReconnectAttempts == 0 && !r.switching {
+		return false
+	}
+	if r.current == t {
+		r.retireLocked()
+	}
+	return true
+}
+
+// reconnect opens the next connection and replays the buffered audio on it.
+func (r *ReconnectingTranscriber) reconnect() error {
+	t, err := r.connect()
+	if err != nil {
+		upstreamReconnects.With("failed").Inc()
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		t.Close()
+		return fmt.Errorf("%w: closed while connecting", ErrTranscriberClosed)
+	}
+	for _, audio := range r.buffer {
+		if err := t.SendAudio(audio); err != nil {
+			t.Close()
+			return fmt.Errorf("%w: failed to replay buffered audio: %w", ErrTranscriberClosed, err)
+		}
+		r.sentBytes += int64(len(audio))
+	}
+	r.buffer = nil
+	r.bufferBytes = 0
+	if r.terminating {
+		// Terminate came in while there was no connection to send it on
+		if err := t.Terminate(); err != nil {
+			t.Close()
+			return fmt.Errorf("%w: failed to terminate: %w", ErrTranscriberClosed, err)
+		}
+	}
+	r.current = t
+	r.resumed = true
+	r.switching = false
+	upstreamReconnects.With("ok").Inc()
+	return nil
+}
+
+// adjust maps the events of the current connection onto the timeline of the whole stream.
+func (r *ReconnectingTranscriber) adjust(event *TranscriptEvent) *TranscriptEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch event.Type {
+	case TRANSCRIPT_BEGIN:
+		if r.resumed {
+			r.resumed = false
+			return &TranscriptEvent{Type: TRANSCRIPT_RECONNECTED}
+		}
+	case TRANSCRIPT_TURN:
+		turn := event.Turn
+		turn.TurnOrder += r.turnOffset
+		r.nextTurn = max(r.nextTurn, turn.TurnOrder+1)
+		if offsetMs := int(r.offsetBytes * 1000 / AUDIO_BYTES_PER_SECOND); offsetMs > 0 {
+			for i := range turn.Words {
+				turn.Words[i].Start += offsetMs
+				turn.Words[i].End += offsetMs
+			}
+		}
+	}
+	return event
+}
+
+// SwitchLanguage retires the current connection when language needs another speech model, the
+// next one is opened with it. Languages of the same model need no new connection.
+func (r *ReconnectingTranscriber) SwitchLanguage(language string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return ErrTranscriberClosed
+	}
+	if r.terminating {
+		return errTerminating
+	}
+	sameModel := speechModel(language) == speechModel(r.language)
+	r.language = language
+	if sameModel || r.current == nil {
+		return nil
+	}
+	slog.Info("switching the upstream speech model", "language", language, "model", speechModel(language))
+	// Receive sees the closed connection and reconnects
+	r.switching = true
+	r.retireLocked()
+	return nil
+}
+
+func (r *ReconnectingTranscriber) Terminate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.terminating = true
+	if r.current == nil {
+		// sent once the next connection is open
+		return nil
+	}
+	return r.current.Terminate()
+}
+
+func (r *ReconnectingTranscriber) ForceEndOfTurn() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		return errReconnecting
+	}
+	return r.current.ForceEndOfTurn()
+}
+
+func (r *ReconnectingTranscriber) Close() error {
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		return nil
+	}
+	return r.current.Close()
+}
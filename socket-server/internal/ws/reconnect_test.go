@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"context"
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/fakeassembly"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+const testFrameBytes = 3200
+
+// TestReconnectKeepsTheTimeline drops the first stream after 16000 bytes (500ms) of audio and
+// sends the rest while the second one can't open yet, so all of it has to be replayed.
+func TestReconnectKeepsTheTimeline(t *testing.T) {
+	script, err := fakeassembly.LoadFixture("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, fake := fakeassembly.Start("test-key", script)
+	t.Cleanup(srv.Close)
+	fake.DropStreams(1, 5*testFrameBytes)
+
+	upstream := config.Default().Upstream
+	upstream.ApiKey = "test-key"
+	upstream.BaseURL = srv.URL
+	release := make(chan struct{})
+	dials := 0
+	dial := func(ctx context.Context, language string) (Transcriber, error) {
+		if dials++; dials > 1 {
+			<-release
+		}
+		return NewAssemblyTranscriber(ctx, upstream, language)
+	}
+	r, err := NewReconnectingTranscriber(context.Background(), upstream, "en", dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	send := func(frames int) {
+		t.Helper()
+		for range frames {
+			if err := r.SendAudio(make([]byte, testFrameBytes)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	receive := func() *TranscriptEvent {
+		t.Helper()
+		event, err := r.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+
+	send(5)
+	var before []*TranscriptTurn
+	for {
+		event := receive()
+		if event.Type == TRANSCRIPT_RECONNECTING {
+			break
+		}
+		if event.Type == TRANSCRIPT_TURN {
+			before = append(before, event.Turn)
+		}
+	}
+	if len(before) == 0 || before[len(before)-1].TurnOrder != 0 {
+		t.Fatalf("turns before the drop: %+v, want turn 0", before)
+	}
+
+	// buffered, the next connection isn't open until release
+	send(10)
+	close(release)
+	if event := receive(); event.Type != TRANSCRIPT_RECONNECTED {
+		t.Fatalf("first event after the drop: %s, want %s", event.Type, TRANSCRIPT_RECONNECTED)
+	}
+
+	// the fake replays its script on the new stream: turn 0 starts again at 320ms
+	event := receive()
+	if event.Type != TRANSCRIPT_TURN {
+		t.Fatalf("got %s, want a turn from the replayed audio", event.Type)
+	}
+	if event.Turn.TurnOrder != 1 {
+		t.Errorf("turn order after the drop: %d, want 1", event.Turn.TurnOrder)
+	}
+	if start := event.Turn.Words[0].Start; start != 320+500 {
+		t.Errorf("first word after the drop starts at %dms, want %dms", start, 320+500)
+	}
+	if n := fake.Sessions(); n != 2 {
+		t.Errorf("fake saw %d streams, want 2", n)
+	}
+}
+
+func TestReconnectTellsTheBrowser(t *testing.T) {
+	url, fake := startTestServer(t, func(s *Server) {})
+	fake.DropStreams(1, 5*testFrameBytes)
+	conn := dialSession(t, url)
+	readUntil(t, conn, READY_RESPONSE)
+
+	for range 10 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, testFrameBytes)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readUntil(t, conn, DEGRADED_RESPONSE)
+	readUntil(t, conn, RECOVERED_RESPONSE)
+	if n := fake.Sessions(); n != 2 {
+		t.Errorf("fake saw %d streams, want 2", n)
+	}
+}
@@ -0,0 +1,99 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"meetingmind-socket/internal/storage"
+	"os"
+	"sync"
+)
+
+const RECORDING_MIME_TYPE = "audio/wav"
+
+// Recorder spools the provider audio of one session to a temp file,
+// it becomes a WAV file in the storage when the session is saved.
+type Recorder struct {
+	mu     sync.Mutex
+	store  storage.Storage
+	tmp    *os.File
+	size   int64
+	closed bool
+}
+
+func NewRecorder(store storage.Storage) (*Recorder, error) {
+	tmp, err := os.CreateTemp("", "meetingmind-session-*.pcm")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording file: %w", err)
+	}
+	return &Recorder{store: store, tmp: tmp}, nil
+}
+
+func (r *Recorder) Write(pcm []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errors.New("recorder is closed")
+	}
+	n, err := r.tmp.Write(pcm)
+	r.size += int64(n)
+	return err
+}
+
+// Finish uploads the recording as a WAV file and returns its size in bytes.
+func (r *Recorder) Finish(ctx context.Context, path string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, errors.New("recorder is closed")
+	}
+	r.closed = true
+	defer r.cleanup()
+
+	if _, err := r.tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind recording: %w", err)
+	}
+	body := io.MultiReader(wavHeader(r.size, ProviderAudioFormat), io.LimitReader(r.tmp, r.size))
+	return r.store.Save(ctx, path, body, RECORDING_MIME_TYPE)
+}
+
+// Discard drops the recording without uploading it.
+func (r *Recorder) Discard() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.cleanup()
+}
+
+func (r *Recorder) cleanup() {
+	r.tmp.Close()
+	os.Remove(r.tmp.Name())
+}
+
+// wavHeader is the 44 byte RIFF header for pcm16 data.
+func wavHeader(dataSize int64, format AudioFormat) io.Reader {
+	header := make([]byte, 44)
+	blockAlign := format.Channels * format.BytesPerSample()
+
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // pcm
+	binary.LittleEndian.PutUint16(header[22:], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(format.SampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], uint16(format.BytesPerSample()*8))
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+
+	return bytes.NewReader(header)
+}
@@ -0,0 +1,405 @@
+package ws
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"meetingmind-socket/internal/middleware"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type ROOM_ROLE string
+
+const (
+	ROOM_SPEAKER ROOM_ROLE = "speaker"
+	ROOM_VIEWER  ROOM_ROLE = "viewer"
+)
+
+type ROOM_EVENT string
+
+const (
+	ROOM_JOIN       ROOM_EVENT = "join"
+	ROOM_LEAVE      ROOM_EVENT = "leave"
+	ROOM_TRANSCRIPT ROOM_EVENT = "transcript"
+	ROOM_TRANSLATE  ROOM_EVENT = "translate"
+	ROOM_CLOSED     ROOM_EVENT = "closed"
+)
+
+const ROOM_RESPONSE RESPONSE_TYPE = "room"
+
+var (
+	errRoomClosed    = errors.New("room is closed")
+	errRoomForbidden = errors.New("not invited to the room")
+)
+
+// RoomWriter is what room members receive about the other participants.
+// Message holds the speaker's transcript or translate message.
+type RoomWriter struct {
+	Sequenced
+	Type      RESPONSE_TYPE `json:"type"`
+	Event     ROOM_EVENT    `json:"event"`
+	RoomId    string        `json:"roomId"`
+	UserId    string        `json:"userId,omitempty"`
+	SessionId string        `json:"sessionId,omitempty"`
+	Role      ROOM_ROLE     `json:"role,omitempty"`
+	Speakers  int           `json:"speakers"`
+	Viewers   int           `json:"viewers"`
+	Message   any           `json:"message,omitempty"`
+}
+
+type roomMember struct {
+	Id     string
+	UserId string
+	Role   ROOM_ROLE
+
+	outbox    chan RoomWriter
+	done      chan struct{}
+	closeOnce sync.Once
+	deliver   func(msg *RoomWriter) error
+	// called once the member stopped receiving
+	onClose func()
+}
+
+// queueSize is how many room messages can wait for the member before it counts as slow.
+func newRoomMember(id string, userId string, role ROOM_ROLE, queueSize int, deliver func(msg *RoomWriter) error) *roomMember {
+	return &roomMember{
+		Id:      id,
+		UserId:  userId,
+		Role:    role,
+		outbox:  make(chan RoomWriter, queueSize),
+		done:    make(chan struct{}),
+		deliver: deliver,
+	}
+}
+
+// run delivers queued messages until the member leaves, what is still queued then is flushed.
+func (m *roomMember) run() {
+	defer func() {
+		if m.onClose != nil {
+			m.onClose()
+		}
+	}()
+	for {
+		select {
+		case msg := <-m.outbox:
+			if err := m.deliver(&msg); err != nil {
+				slog.Info("failed to deliver room message", "member_id", m.Id, "err", err)
+				return
+			}
+		case <-m.done:
+			for {
+				select {
+				case msg := <-m.outbox:
+					if m.deliver(&msg) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *roomMember) stop() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+// Room fans the transcript of one or more speakers out to every member.
+// A slow viewer is dropped instead of blocking the room.
+type Room struct {
+	Id string
+	// the user who asked for the room, everyone else needs Invite to join or view it
+	OwnerId string
+	Invite  string
+
+	mu      sync.Mutex
+	members map[string]*roomMember
+	closed  bool
+	// set once a speaker joined, until then unclaimed closes the room
+	claimed   bool
+	unclaimed *time.Timer
+}
+
+var rooms = struct {
+	sync.Mutex
+	byId map[string]*Room
+}{byId: make(map[string]*Room)}
+
+// issueRoom opens a room owned by ownerId. It closes again if no speaker joins within claimTimeout.
+func issueRoom(ownerId string, claimTimeout time.Duration) *Room {
+	room := &Room{
+		Id:      uuid.NewString(),
+		OwnerId: ownerId,
+		Invite:  rand.Text(),
+		members: make(map[string]*roomMember),
+	}
+	rooms.Lock()
+	rooms.byId[room.Id] = room
+	rooms.Unlock()
+
+	room.mu.Lock()
+	room.unclaimed = time.AfterFunc(claimTimeout, room.closeUnclaimed)
+	room.mu.Unlock()
+	return room
+}
+
+// allows tells whether the user may join or view the room, its owner or anyone with the invite.
+func (r *Room) allows(userId string, invite string) bool {
+	return userId == r.OwnerId || subtle.ConstantTimeCompare([]byte(invite), []byte(r.Invite)) == 1
+}
+
+// joinRoom adds the member to an issued room it is allowed in.
+func joinRoom(roomId string, invite string, member *roomMember) (*Room, error) {
+	room := findRoom(roomId)
+	if room == nil {
+		return nil, errRoomClosed
+	}
+	if !room.allows(member.UserId, invite) {
+		return nil, errRoomForbidden
+	}
+
+	room.mu.Lock()
+	if room.closed {
+		room.mu.Unlock()
+		return nil, errRoomClosed
+	}
+	room.members[member.Id] = member
+	if member.Role == ROOM_SPEAKER && !room.claimed {
+		room.claimed = true
+		room.unclaimed.Stop()
+	}
+	room.mu.Unlock()
+
+	go member.run()
+	room.broadcast(nil, RoomWriter{Event: ROOM_JOIN, UserId: member.UserId, SessionId: member.Id, Role: member.Role})
+	return room, nil
+}
+
+func findRoom(roomId string) *Room {
+	rooms.Lock()
+	defer rooms.Unlock()
+	return rooms.byId[roomId]
+}
+
+// leave removes the member, the room closes with its last speaker.
+func (r *Room) leave(member *roomMember) {
+	r.mu.Lock()
+	if r.members[member.Id] != member {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.members, member.Id)
+	closeRoom := member.Role == ROOM_SPEAKER && r.countLocked(ROOM_SPEAKER) == 0
+	r.mu.Unlock()
+	member.stop()
+
+	r.broadcast(nil, RoomWriter{Event: ROOM_LEAVE, UserId: member.UserId, SessionId: member.Id, Role: member.Role})
+	if closeRoom {
+		r.close()
+	}
+}
+
+func (r *Room) closeUnclaimed() {
+	r.mu.Lock()
+	claimed := r.claimed
+	r.mu.Unlock()
+	if !claimed {
+		slog.Info("closing room nobody spoke in", "room_id", r.Id)
+		r.close()
+	}
+}
+
+func (r *Room) close() {
+	rooms.Lock()
+	if rooms.byId[r.Id] == r {
+		delete(rooms.byId, r.Id)
+	}
+	rooms.Unlock()
+
+	r.broadcast(nil, RoomWriter{Event: ROOM_CLOSED})
+
+	r.mu.Lock()
+	r.closed = true
+	members := r.members
+	r.members = make(map[string]*roomMember)
+	r.mu.Unlock()
+	for _, m := range members {
+		m.stop()
+	}
+	slog.Info("room closed", "room_id", r.Id)
+}
+
+func (r *Room) countLocked(role ROOM_ROLE) int {
+	n := 0
+	for _, m := range r.members {
+		if m.Role == role {
+			n++
+		}
+	}
+	return n
+}
+
+// broadcast queues the message for every member except from, it never blocks.
+func (r *Room) broadcast(from *roomMember, msg RoomWriter) {
+	msg.Type = ROOM_RESPONSE
+	msg.RoomId = r.Id
+
+	r.mu.Lock()
+	msg.Speakers = r.countLocked(ROOM_SPEAKER)
+	msg.Viewers = r.countLocked(ROOM_VIEWER)
+	slow := make([]*roomMember, 0)
+	for _, m := range r.members {
+		if m == from {
+			continue
+		}
+		select {
+		case m.outbox <- msg:
+		default:
+			if m.Role == ROOM_VIEWER {
+				slow = append(slow, m)
+			} else {
+				slog.Warn("speaker is behind, dropping a room message", "room_id", r.Id, "session_id", m.Id)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for _, m := range slow {
+		slog.Warn("dropping slow viewer", "room_id", r.Id, "member_id", m.Id)
+		r.leave(m)
+	}
+}
+
+// joinRoom makes the client a speaker of the room, it receives the other speakers' messages.
+func (c *Client) joinRoom(roomId string, invite string) error {
+	member := newRoomMember(c.SessionId, c.UserId, ROOM_SPEAKER, c.cfg.Room.QueueSize, func(msg *RoomWriter) error {
+		// a detached speaker still gets it through the replay buffer
+		if err := c.send(msg); err != nil {
+			c.Logger.Warn("failed to send room message", "err", err)
+		}
+		return nil
+	})
+	room, err := joinRoom(roomId, invite, member)
+	if err != nil {
+		return err
+	}
+	c.room = room
+	c.roomMember = member
+	return nil
+}
+
+func (c *Client) leaveRoom() {
+	if c.room != nil {
+		c.room.leave(c.roomMember)
+	}
+}
+
+func (c *Client) broadcastToRoom(event ROOM_EVENT, message any) {
+	if c.room == nil {
+		return
+	}
+	c.room.broadcast(c.roomMember, RoomWriter{
+		Event:     event,
+		UserId:    c.UserId,
+		SessionId: c.SessionId,
+		Role:      ROOM_SPEAKER,
+		Message:   message,
+	})
+}
+
+// CreateRoom serves POST /rooms. The caller owns the new room and shares its id and invite
+// with the speakers and viewers they want in it.
+func (s *Server) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	if !s.Config.Features.Rooms {
+		http.NotFound(w, r)
+		return
+	}
+	userId := middleware.UserID(r)
+	room := issueRoom(userId, s.Config.Room.ClaimTimeout)
+	slog.Info("room issued", "user_id", userId, "room_id", room.Id)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"roomId":       room.Id,
+		"invite":       room.Invite,
+		"claimTimeout": s.Config.Room.ClaimTimeout.Seconds(),
+	})
+}
+
+// RunViewer lets the owner of a room, or a user with its invite, follow it without streaming audio:
+// /ws/room?token=...&room=<room id>&invite=<invite>
+func (s *Server) RunViewer(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("incoming room request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+
+	if !s.Config.Features.Rooms {
+		http.NotFound(w, r)
+		return
+	}
+	if s.IsDraining() {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	claims, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	userId := claims.UserID()
+
+	roomId := r.URL.Query().Get("room")
+	invite := r.URL.Query().Get("invite")
+	room := findRoom(roomId)
+	if room == nil {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+	if !room.allows(userId, invite) {
+		slog.Warn("viewer refused, not invited", "user_id", userId, "room_id", roomId)
+		http.Error(w, "not invited to the room", http.StatusForbidden)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "user_id", userId, "err", err)
+		return
+	}
+
+	var seq int64
+	member := newRoomMember(uuid.NewString(), userId, ROOM_VIEWER, s.Config.Room.QueueSize, func(msg *RoomWriter) error {
+		seq++
+		msg.setSeq(seq)
+		conn.SetWriteDeadline(time.Now().Add(s.Config.Room.ViewerWriteTimeout))
+		return conn.WriteJSON(msg)
+	})
+	member.onClose = func() {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "left the room"),
+			time.Now().Add(time.Second))
+		conn.Close()
+	}
+
+	room, err = joinRoom(roomId, invite, member)
+	if err != nil {
+		conn.WriteJSON(NewStatusWriter(ERROR_RESPONSE, "room is closed"))
+		conn.Close()
+		return
+	}
+	slog.Info("viewer joined room", "user_id", userId, "room_id", roomId)
+
+	// viewers don't send anything, reading only notices when they go away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			room.leave(member)
+			return
+		}
+	}
+}
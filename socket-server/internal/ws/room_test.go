@@ -0,0 +1,214 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJoinRoomChecksTheInvite(t *testing.T) {
+	room := issueRoom("owner", time.Minute)
+	t.Cleanup(room.close)
+
+	tests := []struct {
+		name    string
+		roomId  string
+		userId  string
+		invite  string
+		role    ROOM_ROLE
+		wantErr error
+	}{
+		{name: "owner without invite", roomId: room.Id, userId: "owner", role: ROOM_SPEAKER},
+		{name: "speaker with invite", roomId: room.Id, userId: "guest", invite: room.Invite, role: ROOM_SPEAKER},
+		{name: "viewer with invite", roomId: room.Id, userId: "guest", invite: room.Invite, role: ROOM_VIEWER},
+		{name: "speaker without invite", roomId: room.Id, userId: "guest", role: ROOM_SPEAKER, wantErr: errRoomForbidden},
+		{name: "viewer with a wrong invite", roomId: room.Id, userId: "guest", invite: "guess", role: ROOM_VIEWER, wantErr: errRoomForbidden},
+		{name: "room that was never issued", roomId: "made-up", userId: "owner", role: ROOM_SPEAKER, wantErr: errRoomClosed},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			member := newRoomMember(string(rune('a'+i)), tt.userId, tt.role, 1, func(msg *RoomWriter) error { return nil })
+			_, err := joinRoom(tt.roomId, tt.invite, member)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("joinRoom: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnclaimedRoomCloses(t *testing.T) {
+	room := issueRoom("owner", 10*time.Millisecond)
+	waitFor(t, "unclaimed room to close", func() bool { return findRoom(room.Id) == nil })
+
+	claimed := issueRoom("owner", 10*time.Millisecond)
+	t.Cleanup(claimed.close)
+	if _, err := joinRoom(claimed.Id, "", newRoomMember("speaker", "owner", ROOM_SPEAKER, 1, func(msg *RoomWriter) error { return nil })); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if findRoom(claimed.Id) == nil {
+		t.Error("a room with a speaker was closed as unclaimed")
+	}
+}
+
+// recordingMember keeps what the room delivers to it.
+func recordingMember(id string, userId string, role ROOM_ROLE, queueSize int) (*roomMember, chan RoomWriter) {
+	received := make(chan RoomWriter, 100)
+	return newRoomMember(id, userId, role, queueSize, func(msg *RoomWriter) error {
+		received <- *msg
+		return nil
+	}), received
+}
+
+func nextRoomMessage(t *testing.T, received chan RoomWriter) RoomWriter {
+	t.Helper()
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no room message")
+		return RoomWriter{}
+	}
+}
+
+func noRoomMessage(t *testing.T, who string, received chan RoomWriter) {
+	t.Helper()
+	select {
+	case msg := <-received:
+		t.Errorf("%s received %+v", who, msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestRoomFansOutToViewers(t *testing.T) {
+	room := issueRoom("owner", time.Minute)
+	speaker, fromRoom := recordingMember("speaker", "owner", ROOM_SPEAKER, 8)
+	if _, err := joinRoom(room.Id, "", speaker); err != nil {
+		t.Fatal(err)
+	}
+	if own := nextRoomMessage(t, fromRoom); own.Event != ROOM_JOIN || own.SessionId != "speaker" || own.Speakers != 1 {
+		t.Errorf("speaker got %+v, want its own join", own)
+	}
+
+	var viewers []chan RoomWriter
+	for i, id := range []string{"viewer-1", "viewer-2"} {
+		viewer, received := recordingMember(id, "guest", ROOM_VIEWER, 8)
+		if _, err := joinRoom(room.Id, room.Invite, viewer); err != nil {
+			t.Fatal(err)
+		}
+		// everyone already in the room hears of the new viewer, the viewer itself too
+		join := nextRoomMessage(t, fromRoom)
+		if join.Event != ROOM_JOIN || join.SessionId != id || join.Role != ROOM_VIEWER || join.Speakers != 1 || join.Viewers != i+1 {
+			t.Errorf("speaker got %+v, want the join of %s", join, id)
+		}
+		for _, earlier := range viewers {
+			if msg := nextRoomMessage(t, earlier); msg.Event != ROOM_JOIN || msg.SessionId != id {
+				t.Errorf("earlier viewer got %+v, want the join of %s", msg, id)
+			}
+		}
+		if own := nextRoomMessage(t, received); own.Event != ROOM_JOIN || own.SessionId != id {
+			t.Errorf("%s got %+v, want its own join", id, own)
+		}
+		viewers = append(viewers, received)
+	}
+
+	room.broadcast(speaker, RoomWriter{Event: ROOM_TRANSCRIPT, SessionId: "speaker", Role: ROOM_SPEAKER, Message: "hello world"})
+	for i, received := range viewers {
+		msg := nextRoomMessage(t, received)
+		if msg.Type != ROOM_RESPONSE || msg.Event != ROOM_TRANSCRIPT || msg.RoomId != room.Id || msg.Message != "hello world" {
+			t.Errorf("viewer %d got %+v, want the transcript", i+1, msg)
+		}
+	}
+	noRoomMessage(t, "the speaker its own transcript", fromRoom)
+
+	room.leave(room.members["viewer-1"])
+	leave := nextRoomMessage(t, fromRoom)
+	if leave.Event != ROOM_LEAVE || leave.SessionId != "viewer-1" || leave.Viewers != 1 {
+		t.Errorf("speaker got %+v, want viewer-1 leaving", leave)
+	}
+	if msg := nextRoomMessage(t, viewers[1]); msg.Event != ROOM_LEAVE {
+		t.Errorf("viewer-2 got %+v, want viewer-1 leaving", msg)
+	}
+
+	// the room closes with its last speaker
+	room.leave(speaker)
+	if msg := nextRoomMessage(t, viewers[1]); msg.Event != ROOM_LEAVE || msg.SessionId != "speaker" || msg.Speakers != 0 {
+		t.Errorf("viewer-2 got %+v, want the speaker leaving", msg)
+	}
+	if msg := nextRoomMessage(t, viewers[1]); msg.Event != ROOM_CLOSED {
+		t.Errorf("viewer-2 got %+v, want the room closing", msg)
+	}
+	if findRoom(room.Id) != nil {
+		t.Error("room without speakers is still open")
+	}
+}
+
+func TestSlowViewerIsDropped(t *testing.T) {
+	room := issueRoom("owner", time.Minute)
+	t.Cleanup(room.close)
+	speaker, _ := recordingMember("speaker", "owner", ROOM_SPEAKER, 8)
+	if _, err := joinRoom(room.Id, "", speaker); err != nil {
+		t.Fatal(err)
+	}
+	fast, fastReceived := recordingMember("fast", "guest", ROOM_VIEWER, 8)
+	if _, err := joinRoom(room.Id, room.Invite, fast); err != nil {
+		t.Fatal(err)
+	}
+
+	// a viewer whose connection doesn't take writes, its single slot fills up
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+	slow := newRoomMember("slow", "guest", ROOM_VIEWER, 1, func(msg *RoomWriter) error {
+		<-release
+		return nil
+	})
+	closed := make(chan struct{})
+	slow.onClose = func() { close(closed) }
+	if _, err := joinRoom(room.Id, room.Invite, slow); err != nil {
+		t.Fatal(err)
+	}
+
+	broadcastDone := make(chan struct{})
+	go func() {
+		defer close(broadcastDone)
+		for range 4 {
+			room.broadcast(speaker, RoomWriter{Event: ROOM_TRANSCRIPT, Message: "words"})
+		}
+	}()
+	select {
+	case <-broadcastDone:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast blocked on a slow viewer")
+	}
+
+	room.mu.Lock()
+	_, stillThere := room.members["slow"]
+	room.mu.Unlock()
+	if stillThere {
+		t.Fatal("slow viewer is still in the room")
+	}
+
+	transcripts := 0
+	for transcripts < 4 {
+		msg := nextRoomMessage(t, fastReceived)
+		switch msg.Event {
+		case ROOM_TRANSCRIPT:
+			transcripts++
+		case ROOM_LEAVE:
+			if msg.SessionId != "slow" {
+				t.Errorf("fast viewer got %+v, want the slow viewer leaving", msg)
+			}
+		}
+	}
+
+	// once its write gives up the slow viewer's connection is closed
+	unblock()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow viewer was not closed")
+	}
+}
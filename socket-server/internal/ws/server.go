@@ -1,70 +1,228 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"meetingmind-socket/internal/config"
+	"meetingmind-socket/internal/middleware"
+	"meetingmind-socket/internal/service"
+	"meetingmind-socket/internal/storage"
 	"meetingmind-socket/internal/validation"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var testing = os.Getenv("IS_USING_CLIENT_TEST")
+// Server serves the browser websockets. Everything it reads comes from Config,
+// the factories and storage can be swapped, e.g. for the fake AssemblyAI in tests.
+type Server struct {
+	Config         *config.Config
+	NewTranscriber TranscriberFactory
+	// nil without a translation api, live translation is then off
+	NewTranslator    TranslatorFactory
+	RecordingStorage storage.Storage
+	Verifier         *validation.Verifier
+	// the plan of connecting users, finished sessions and their usage, swap them out to run without a database
+	LookupEntitlement EntitlementLookup
+	SaveSession       SessionSaver
+	RecordUsage       UsageRecorder
 
-var upgrader = websocket.Upgrader{
+	upgrader websocket.Upgrader
+	draining atomic.Bool
+}
 
-	CheckOrigin: func(r *http.Request) bool {
-		if testing == "true" {
-			return true
+func NewServer(cfg *config.Config) (*Server, error) {
+	recordingStorage, err := storage.New(cfg.Recording.Storage, cfg.Recording.Dir)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := validation.NewVerifier(cfg.SupabaseJwtKey, cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Config: cfg,
+		NewTranscriber: func(ctx context.Context, language string) (Transcriber, error) {
+			return NewReconnectingTranscriber(ctx, cfg.Upstream, language, func(ctx context.Context, language string) (Transcriber, error) {
+				return NewAssemblyTranscriber(ctx, cfg.Upstream, language)
+			})
+		},
+		RecordingStorage:  recordingStorage,
+		Verifier:          verifier,
+		LookupEntitlement: service.GetEntitlement,
+		SaveSession:       service.SaveLiveSession,
+		RecordUsage:       service.RecordUsage,
+	}
+	if cfg.Translate.ApiURL != "" {
+		s.NewTranslator = func() Translator {
+			return NewHTTPTranslator(cfg.Translate.ApiURL, cfg.Translate.ApiKey)
 		}
-		frontendUrl := os.Getenv("FRONTEND_URL")
-		origin := r.Header.Get("Origin")
-		return origin == frontendUrl
-	},
+	} else if cfg.Features.Translation {
+		slog.Warn("TRANSLATE_API_URL is not set, live translation is off")
+	}
+	s.upgrader = websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	return s, nil
 }
 
-func RunServer(w http.ResponseWriter, r *http.Request) {
-	log.Println("Incoming request:", r.Method, r.URL.Path)
+func (s *Server) checkOrigin(r *http.Request) bool {
+	if s.Config.AllowAnyOrigin {
+		return true
+	}
+	return slices.Contains(s.Config.Origins(), r.Header.Get("Origin"))
+}
 
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, "missing token", 401)
-		log.Println("Missing token in request")
+func (s *Server) RunServer(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("incoming websocket request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+
+	if s.IsDraining() {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
 		return
 	}
 
-	userId, err := validation.ValidateSupabaseJWT(token, os.Getenv("SUPABASE_JWT_KEY"))
+	claims, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	userId := claims.UserID()
+
+	audioFormat, err := ParseAudioFormat(r.URL.Query())
 	if err != nil {
-		http.Error(w, "invalid token", 401)
-		log.Println("Invalid token:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		slog.Warn("websocket upgrade failed", "user_id", userId, "err", err)
 		// no need to write an error response here, as the upgrade has already failed
 		return
 	}
+	conn.SetReadLimit(s.Config.Session.MaxMessageBytes)
 
-	assemblyAIKey := os.Getenv("ASSEMBLYAI_API_KEY")
-	assemblyConn, res, err := ConnectToAssemblyAI(assemblyAIKey)
-	if err != nil {
+	// a client that lost its connection comes back with ?session_id=...&last_seq=...
+	if sessionId := r.URL.Query().Get("session_id"); sessionId != "" && s.Config.Features.Resume {
+		client := FindSession(sessionId)
+		lastSeq, _ := strconv.ParseInt(r.URL.Query().Get("last_seq"), 10, 64)
+		if client != nil && client.UserId == userId && client.Reattach(conn, lastSeq) {
+			client.trackToken(claims)
+			return
+		}
+		slog.Info("session to resume not found, starting a new one", "user_id", userId, "session_id", sessionId)
+	}
 
-		log.Println("Assembly Error : ", res)
+	entitlement, refusal := s.entitlementFor(userId)
+	if refusal != "" {
+		slog.Info("session refused by plan", "user_id", userId, "plan", entitlement.Plan.Key, "reason", refusal)
+		rejectConn(conn, refusal)
+		return
+	}
+
+	transcriber, err := s.NewTranscriber(r.Context(), DEFAULT_SOURCE_LANGUAGE)
+	if err != nil {
+		slog.Error("failed to open transcriber", "user_id", userId, "err", err)
 		conn.WriteJSON(map[string]string{
 			"type":    "error",
 			"message": "Server can't transcript right now",
 		})
 		conn.Close()
-		if assemblyConn != nil {
-			assemblyConn.Close()
-		}
-
 		return
 	}
 
-	client := NewClient(userId, conn, assemblyConn)
+	client := NewClient(s.Config, userId, conn, transcriber)
+	if !s.admit(client, entitlement) {
+		slog.Info("session refused, too many sessions", "user_id", userId, "plan", entitlement.Plan.Key)
+		transcriber.Close()
+		rejectConn(conn, s.limitRefusal(entitlement))
+		return
+	}
+	client.verifier = s.Verifier
+	client.saveSessionFn = s.SaveSession
+	client.recordUsageFn = s.RecordUsage
+	client.Audio = NewAudioConverter(audioFormat)
+	if s.NewTranslator != nil {
+		client.Translator = s.NewTranslator()
+	}
+	client.applyEntitlement(entitlement)
+	if s.RecordingStorage != nil {
+		recorder, err := NewRecorder(s.RecordingStorage)
+		if err != nil {
+			client.Logger.Warn("recording disabled for this session", "err", err)
+		} else {
+			client.Recorder = recorder
+		}
+	}
+	// optional, e.g. ?translate_to=vi
+	if client.canTranslate() && entitlement.Plan.Translation {
+		client.SetTargetLanguage(r.URL.Query().Get("translate_to"))
+	}
+	// optional, speakers of an issued room are heard by the same viewers
+	if roomId := r.URL.Query().Get("room"); roomId != "" && s.Config.Features.Rooms {
+		if err := client.joinRoom(roomId, r.URL.Query().Get("invite")); errors.Is(err, errRoomForbidden) {
+			client.Logger.Warn("refused to join room, not invited", "room_id", roomId)
+			client.send(NewStatusWriter(ERROR_RESPONSE, "You are not invited to this room"))
+		} else if err != nil {
+			client.Logger.Warn("failed to join room", "room_id", roomId, "err", err)
+			client.send(NewStatusWriter(ERROR_RESPONSE, "Can't join the room right now"))
+		}
+	}
 
 	RegisterClient(client)
+	client.trackToken(claims)
+}
+
+// admit enforces the session limit of the user, with the takeover policy their oldest sessions
+// are ended to make room for the new one. Detached sessions in the way are ended whatever the policy.
+func (s *Server) admit(client *Client, entitlement service.Entitlement) bool {
+	client.maxSessions = s.sessionLimit(entitlement)
+	abandoned, displaced, ok := admitSession(client, client.maxSessions, s.takesOver())
+	if !ok {
+		return false
+	}
+	for _, old := range abandoned {
+		old.Logger.Info("detached session replaced", "by_session_id", client.SessionId)
+		old.Close(ErrAbandoned)
+	}
+	for _, old := range displaced {
+		old.Logger.Info("session taken over", "by_session_id", client.SessionId)
+		old.send(NewStatusWriter(TAKEN_OVER_RESPONSE, "This session was taken over by a new connection"))
+		old.Close(ErrTakenOver)
+	}
+	return true
+}
+
+// authenticate checks the ?token= query, browsers can't set headers on a websocket upgrade.
+// A token IdentifyUser already verified isn't verified again.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*validation.Claims, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", 401)
+		slog.Info("missing token in request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		return nil, false
+	}
+	if claims := middleware.VerifiedClaims(r, token); claims != nil {
+		return claims, true
+	}
+
+	claims, err := s.Verifier.Verify(token)
+	if err != nil {
+		http.Error(w, "invalid token", 401)
+		slog.Info("invalid token", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "err", err)
+		return nil, false
+	}
+	return claims, true
+}
+
+// rejectConn explains why the session can't start and closes the new connection.
+func rejectConn(conn *websocket.Conn, message string) {
+	conn.WriteJSON(NewStatusWriter(ERROR_RESPONSE, message))
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session refused"),
+		time.Now().Add(time.Second))
+	conn.Close()
 }
@@ -0,0 +1,235 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type replayEntry struct {
+	seq int64
+	msg []byte
+}
+
+// sessions is the registry of live sessions, by id and by user in start order.
+// reserved counts per user the sessions admitted but still being set up, see admitSession.
+var sessions = struct {
+	sync.Mutex
+	byId     map[string]*Client
+	byUser   map[string][]*Client
+	reserved map[string]int
+}{byId: make(map[string]*Client), byUser: make(map[string][]*Client), reserved: make(map[string]int)}
+
+// registerSession releases the slot admitSession reserved and puts the session in the registry,
+// unless it already ended: Close only takes registered sessions out.
+func registerSession(c *Client) bool {
+	sessions.Lock()
+	defer sessions.Unlock()
+	if sessions.reserved[c.UserId]--; sessions.reserved[c.UserId] <= 0 {
+		delete(sessions.reserved, c.UserId)
+	}
+	if c.isClosed() {
+		return false
+	}
+	addSessionLocked(c)
+	return true
+}
+
+func addSessionLocked(c *Client) {
+	if sessions.byId[c.SessionId] == c {
+		return
+	}
+	sessions.byId[c.SessionId] = c
+	sessions.byUser[c.UserId] = append(sessions.byUser[c.UserId], c)
+}
+
+func removeSession(c *Client) {
+	sessions.Lock()
+	removeSessionLocked(c)
+	sessions.Unlock()
+}
+
+func removeSessionLocked(c *Client) {
+	if sessions.byId[c.SessionId] != c {
+		return
+	}
+	delete(sessions.byId, c.SessionId)
+	remaining := slices.DeleteFunc(sessions.byUser[c.UserId], func(other *Client) bool { return other == c })
+	if len(remaining) == 0 {
+		delete(sessions.byUser, c.UserId)
+	} else {
+		sessions.byUser[c.UserId] = remaining
+	}
+}
+
+// admitSession reserves a slot for a new session unless its user already runs limit sessions.
+// Detached sessions of the user don't count: while they fill the limit the oldest of them is
+// abandoned, the browser moved on without resuming it. With takeover the oldest sessions of the
+// user make room instead of a refusal, they are returned as displaced. Both come back already out
+// of the registry for the caller to end. The new session only enters the registry through
+// registerSession once it is set up, nothing can find and end it halfway.
+func admitSession(c *Client, limit int, takeover bool) (abandoned []*Client, displaced []*Client, ok bool) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	reserved := sessions.reserved[c.UserId]
+	if !takeover && countActiveSessionsLocked(c.UserId)+reserved >= limit {
+		return nil, nil, false
+	}
+	// sessions still being set up can't be taken over, they are past the limit for a moment
+	for len(sessions.byUser[c.UserId]) > 0 && len(sessions.byUser[c.UserId])+reserved >= limit {
+		running := sessions.byUser[c.UserId]
+		oldest := running[0]
+		if i := slices.IndexFunc(running, func(old *Client) bool { return old.detached.Load() }); i >= 0 {
+			oldest = running[i]
+			abandoned = append(abandoned, oldest)
+		} else {
+			displaced = append(displaced, oldest)
+		}
+		removeSessionLocked(oldest)
+	}
+	sessions.reserved[c.UserId]++
+	return abandoned, displaced, true
+}
+
+func allSessions() []*Client {
+	sessions.Lock()
+	defer sessions.Unlock()
+	clients := make([]*Client, 0, len(sessions.byId))
+	for _, c := range sessions.byId {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func countSessions() int {
+	sessions.Lock()
+	defer sessions.Unlock()
+	return len(sessions.byId)
+}
+
+// countActiveSessions counts the sessions of the user that count toward their limit, detached ones don't.
+func countActiveSessions(userId string) int {
+	sessions.Lock()
+	defer sessions.Unlock()
+	return countActiveSessionsLocked(userId)
+}
+
+func countActiveSessionsLocked(userId string) int {
+	n := 0
+	for _, c := range sessions.byUser[userId] {
+		if !c.detached.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+func FindSession(sessionId string) *Client {
+	sessions.Lock()
+	defer sessions.Unlock()
+	return sessions.byId[sessionId]
+}
+
+// send numbers the message, keeps it for replay and writes it to the browser.
+// While the browser is detached the message is only kept for replay.
+func (c *Client) send(msg sequencedMessage) error {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	c.seq++
+	msg.setSeq(c.seq)
+	byteMsg, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.replay = append(c.replay, replayEntry{seq: c.seq, msg: byteMsg})
+	if maxReplay := c.cfg.Session.MaxReplayMessages; len(c.replay) > maxReplay {
+		c.replay = c.replay[len(c.replay)-maxReplay:]
+	}
+
+	if c.Conn == nil {
+		return nil
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(c.cfg.Session.WriteTimeout))
+	if err := c.Conn.WriteMessage(websocket.TextMessage, byteMsg); err != nil {
+		// the connection is unusable after a failed write, the reader detaches or ends the session
+		c.Conn.Close()
+		return err
+	}
+	return nil
+}
+
+// detach drops a broken browser connection but keeps the session alive
+// for the resume grace window so the same user can reattach to it.
+func (c *Client) detach(conn *websocket.Conn) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	if c.Conn != conn || c.isClosed() {
+		return
+	}
+	conn.Close()
+	c.Conn = nil
+	c.detached.Store(true)
+
+	graceWindow := c.cfg.Session.ResumeGraceWindow
+	c.Logger.Info("client detached, waiting for resume", "grace_window", graceWindow)
+	c.resumeTimer = time.AfterFunc(graceWindow, func() {
+		c.Mu.Lock()
+		stillDetached := c.Conn == nil
+		c.Mu.Unlock()
+		if stillDetached {
+			c.Logger.Info("resume window passed")
+			c.Close(ErrResumeExpired)
+		}
+	})
+}
+
+func (c *Client) isDetached() bool {
+	return c.detached.Load()
+}
+
+// Reattach swaps in the new browser connection and replays every message after lastSeq.
+// It returns false when the session already ended.
+func (c *Client) Reattach(conn *websocket.Conn, lastSeq int64) bool {
+	c.Mu.Lock()
+	if c.isClosed() {
+		c.Mu.Unlock()
+		return false
+	}
+	if c.resumeTimer != nil {
+		c.resumeTimer.Stop()
+		c.resumeTimer = nil
+	}
+	if c.Conn != nil {
+		// the old connection is still around, the new one wins
+		c.Conn.Close()
+	}
+	c.Conn = conn
+	c.detached.Store(false)
+	c.slow.Store(false)
+
+	replayed := 0
+	for _, entry := range c.replay {
+		if entry.seq <= lastSeq {
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(c.cfg.Session.WriteTimeout))
+		if err := conn.WriteMessage(websocket.TextMessage, entry.msg); err != nil {
+			c.Logger.Warn("failed to replay message", "seq", entry.seq, "err", err)
+			break
+		}
+		replayed++
+	}
+	// spawned under Mu, Close takes Mu before it waits for the session goroutines
+	c.spawn("processClientAudio", func(ctx context.Context) error { return c.processClientAudio(ctx, conn) })
+	c.Mu.Unlock()
+
+	c.Logger.Info("client resumed session", "remote_addr", conn.RemoteAddr().String(), "replayed", replayed)
+	return true
+}
@@ -0,0 +1,161 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"meetingmind-socket/internal/config"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// A free user reloading the page opens a new session while the old one waits for resume.
+func TestDetachedSessionDoesNotCountTowardTheLimit(t *testing.T) {
+	url, _ := startTestServer(t, func(s *Server) {
+		s.Config.Features.Resume = true
+		s.Config.Session.ResumeGraceWindow = time.Minute
+	})
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := readUntil(t, first, SESSION_RESPONSE)
+	old := FindSession(session["sessionId"].(string))
+	first.Close()
+	waitFor(t, "session to detach", old.isDetached)
+
+	second := dialSession(t, url)
+	readUntil(t, second, READY_RESPONSE)
+	waitFor(t, "detached session to end", func() bool { return countSessions() == 1 })
+	if cause := old.Cause(); !errors.Is(cause, ErrAbandoned) {
+		t.Errorf("detached session ended with %v, want %v", cause, ErrAbandoned)
+	}
+}
+
+// nopTranscriber stands in for the upstream of sessions that never stream.
+type nopTranscriber struct{}
+
+func (nopTranscriber) SendAudio(audio []byte) error       { return nil }
+func (nopTranscriber) Receive() (*TranscriptEvent, error) { return nil, ErrTranscriberClosed }
+func (nopTranscriber) Terminate() error                   { return nil }
+func (nopTranscriber) ForceEndOfTurn() error              { return nil }
+func (nopTranscriber) Close() error                       { return nil }
+
+// A session ended while it was set up, by a takeover, an admin or a drain, must not be registered
+// afterwards: nothing would ever take it out again.
+func TestSessionClosedBeforeRegisterStaysOut(t *testing.T) {
+	cfg := config.Default()
+	client := NewClient(cfg, "closed-early", nil, nopTranscriber{})
+	if _, _, ok := admitSession(client, 1, false); !ok {
+		t.Fatal("first session refused")
+	}
+	if _, _, ok := admitSession(NewClient(cfg, "closed-early", nil, nopTranscriber{}), 1, false); ok {
+		t.Fatal("the reserved slot was given to a second session")
+	}
+
+	client.Close(ErrTerminated)
+	if registerSession(client) {
+		t.Fatal("a closed session was registered")
+	}
+	WaitForSaves()
+	if n := countSessions(); n != 0 {
+		t.Fatalf("%d sessions registered, want 0", n)
+	}
+
+	// the reservation was released with it
+	next := NewClient(cfg, "closed-early", nil, nopTranscriber{})
+	if _, _, ok := admitSession(next, 1, false); !ok {
+		t.Fatal("the slot of the closed session was not released")
+	}
+	if !registerSession(next) {
+		t.Fatal("an open session was not registered")
+	}
+	next.Close(ErrTerminated)
+	WaitForSaves()
+}
+
+// TestResumeReplaysMissedMessages drops the browser mid transcript and resumes with the last seq it
+// got, exactly the messages sent after it come back, in order.
+func TestResumeReplaysMissedMessages(t *testing.T) {
+	url, _ := startTestServer(t, func(s *Server) {
+		s.Config.Features.Resume = true
+		s.Config.Session.ResumeGraceWindow = time.Minute
+	})
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionId := readUntil(t, first, SESSION_RESPONSE)["sessionId"].(string)
+	client := FindSession(sessionId)
+	readUntil(t, first, READY_RESPONSE)
+	for range 15 {
+		if err := first.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastSeq := int64(readUntil(t, first, TRANSCRIPT_RESPONSE)["seq"].(float64))
+	first.Close()
+	waitFor(t, "session to detach", client.isDetached)
+	// the rest of the fixture is transcribed while nobody listens
+	waitFor(t, "both turns", func() bool { return len(client.Transcript.FinishedTurns()) == 2 })
+
+	client.Mu.Lock()
+	var want []int64
+	for _, entry := range client.replay {
+		if entry.seq > lastSeq {
+			want = append(want, entry.seq)
+		}
+	}
+	client.Mu.Unlock()
+	if len(want) == 0 || want[0] != lastSeq+1 {
+		t.Fatalf("messages to replay after seq %d: %v", lastSeq, want)
+	}
+
+	second := dialSession(t, fmt.Sprintf("%s&session_id=%s&last_seq=%d", url, sessionId, lastSeq))
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []int64
+	for len(got) < len(want) {
+		var msg map[string]any
+		if err := second.ReadJSON(&msg); err != nil {
+			t.Fatalf("replayed %v, want %v: %v", got, want, err)
+		}
+		got = append(got, int64(msg["seq"].(float64)))
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+	if client.isDetached() || FindSession(sessionId) != client || countSessions() != 1 {
+		t.Fatal("the resumed session was not reattached")
+	}
+}
+
+// A session id is no secret, it shows up in logs: only its own user can take the session back.
+func TestResumeRefusesAnotherUser(t *testing.T) {
+	url, _ := startTestServer(t, func(s *Server) {
+		s.Config.Features.Resume = true
+		s.Config.Session.ResumeGraceWindow = time.Minute
+	})
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionId := readUntil(t, first, SESSION_RESPONSE)["sessionId"].(string)
+	client := FindSession(sessionId)
+	first.Close()
+	waitFor(t, "session to detach", client.isDetached)
+
+	other := dialSession(t, fmt.Sprintf("%s&session_id=%s&last_seq=0", withToken(url, testToken(t, "other-user", time.Hour)), sessionId))
+	// runs before the cleanup of dialSession, which waits for every session to end
+	t.Cleanup(func() { client.Close(ErrClientClosed) })
+	if got := readUntil(t, other, SESSION_RESPONSE)["sessionId"]; got == sessionId {
+		t.Fatal("another user resumed the session")
+	}
+	if !client.isDetached() {
+		t.Error("the session of the first user lost its detached state")
+	}
+}
@@ -0,0 +1,99 @@
+package ws
+
+import (
+	"meetingmind-socket/internal/validation"
+	"time"
+)
+
+const TOKEN_EXPIRING_RESPONSE RESPONSE_TYPE = "token_expiring"
+
+// TokenWriter warns the browser its access token is about to expire,
+// a refresh_token control with a fresh one keeps the session going.
+type TokenWriter struct {
+	Sequenced
+	Type      RESPONSE_TYPE `json:"type"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	Message   string        `json:"message"`
+}
+
+func (c *Client) TokenExpiresAt() time.Time {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return c.tokenExpiresAt
+}
+
+// trackToken takes the expiry of the latest token the client proved,
+// it is warned TokenExpiryWarning before and the session ends when it passes.
+func (c *Client) trackToken(claims *validation.Claims) {
+	if claims.ExpiresAt == nil {
+		return
+	}
+	expiresAt := claims.ExpiresAt.Time
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	if c.isClosed() {
+		return
+	}
+	c.tokenExpiresAt = expiresAt
+	c.scheduleTokenCheckLocked(expiresAt, time.Until(expiresAt)-c.cfg.Session.TokenExpiryWarning)
+}
+
+func (c *Client) scheduleTokenCheckLocked(expiresAt time.Time, in time.Duration) {
+	if c.tokenTimer != nil {
+		c.tokenTimer.Stop()
+	}
+	c.tokenTimer = time.AfterFunc(max(in, 0), func() { c.checkToken(expiresAt) })
+}
+
+// checkToken warns about a token that expires soon and ends the session once it expired,
+// unless a refresh came in meanwhile.
+func (c *Client) checkToken(expiresAt time.Time) {
+	c.Mu.Lock()
+	current := c.tokenExpiresAt.Equal(expiresAt)
+	detached := c.Conn == nil
+	c.Mu.Unlock()
+	if !current || c.isClosed() {
+		return
+	}
+
+	if remaining := time.Until(expiresAt); remaining > 0 {
+		c.Logger.Info("access token expiring", "expires_at", expiresAt)
+		c.send(&TokenWriter{
+			Type:      TOKEN_EXPIRING_RESPONSE,
+			ExpiresAt: expiresAt,
+			Message:   "Your login is about to expire, send a refresh_token control to keep the session going",
+		})
+		c.Mu.Lock()
+		if c.tokenExpiresAt.Equal(expiresAt) {
+			c.scheduleTokenCheckLocked(expiresAt, remaining)
+		}
+		c.Mu.Unlock()
+		return
+	}
+
+	if detached {
+		// resuming needs a valid token anyway, the resume window ends the session otherwise
+		return
+	}
+	c.Logger.Info("access token expired, ending session", "expires_at", expiresAt)
+	c.send(NewStatusWriter(ERROR_RESPONSE, "Your login expired, please sign in again"))
+	c.Close(ErrTokenExpired)
+}
+
+// refresh_token swaps in a fresh access token of the same user.
+func (c *Client) handleRefreshToken(msg *ControlMessage) (any, *ControlError) {
+	if c.verifier == nil {
+		return nil, &ControlError{CONTROL_ERR_INVALID_STATE, "token refresh is not available"}
+	}
+	claims, err := c.verifier.Verify(msg.Token)
+	if err != nil {
+		c.Logger.Info("refreshed token rejected", "err", err)
+		return nil, &ControlError{CONTROL_ERR_INVALID_TOKEN, "token is invalid or expired"}
+	}
+	if claims.UserID() != c.UserId {
+		return nil, &ControlError{CONTROL_ERR_INVALID_TOKEN, "token belongs to another user"}
+	}
+	c.trackToken(claims)
+	return map[string]time.Time{"tokenExpiresAt": claims.ExpiresAt.Time}, nil
+}
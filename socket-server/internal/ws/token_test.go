@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tokenWarning is the TokenExpiryWarning of these tests, a token of tokenTTL is warned about right away.
+const (
+	tokenWarning = 2 * time.Second
+	tokenTTL     = 3 * time.Second
+)
+
+func startTokenSession(t *testing.T, userId string) (*websocket.Conn, *Client) {
+	t.Helper()
+	url, _ := startTestServer(t, func(s *Server) {
+		s.Config.Session.TokenExpiryWarning = tokenWarning
+	})
+	conn := dialSession(t, withToken(url, testToken(t, userId, tokenTTL)))
+	client := FindSession(readUntil(t, conn, SESSION_RESPONSE)["sessionId"].(string))
+	return conn, client
+}
+
+func refreshToken(t *testing.T, conn *websocket.Conn, token string) {
+	t.Helper()
+	if err := conn.WriteJSON(ControlMessage{Type: CONTROL_REFRESH_TOKEN, Token: token}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTokenExpiryEndsTheSession lets the token run out: the browser is warned TokenExpiryWarning
+// before, then told and the session ends.
+func TestTokenExpiryEndsTheSession(t *testing.T) {
+	conn, client := startTokenSession(t, "token-user")
+	expiresAt := client.TokenExpiresAt()
+
+	warning := readUntil(t, conn, TOKEN_EXPIRING_RESPONSE)
+	if remaining := time.Until(expiresAt); remaining > tokenWarning || remaining < tokenWarning-500*time.Millisecond {
+		t.Errorf("warned %s before expiry, want %s", remaining, tokenWarning)
+	}
+	if at, err := time.Parse(time.RFC3339, warning["expiresAt"].(string)); err != nil || !at.Equal(expiresAt) {
+		t.Errorf("warning names expiry %v, want %s", warning["expiresAt"], expiresAt)
+	}
+
+	readUntil(t, conn, ERROR_RESPONSE)
+	if time.Now().Before(expiresAt) {
+		t.Errorf("session ended %s before the token expired", time.Until(expiresAt))
+	}
+	waitFor(t, "session to end", func() bool { return countSessions() == 0 })
+	if cause := client.Cause(); !errors.Is(cause, ErrTokenExpired) {
+		t.Errorf("session ended with %v, want %v", cause, ErrTokenExpired)
+	}
+}
+
+func TestRefreshTokenMovesTheDeadline(t *testing.T) {
+	conn, client := startTokenSession(t, "token-user")
+	expiresAt := client.TokenExpiresAt()
+	readUntil(t, conn, TOKEN_EXPIRING_RESPONSE)
+
+	refreshToken(t, conn, testToken(t, "token-user", time.Hour))
+	ack := readUntil(t, conn, ACK_RESPONSE)
+	if ack["control"] != string(CONTROL_REFRESH_TOKEN) {
+		t.Fatalf("ack %v, want one of the refresh", ack)
+	}
+	refreshed := client.TokenExpiresAt()
+	if !refreshed.After(expiresAt.Add(time.Minute)) {
+		t.Fatalf("token expires at %s after the refresh, want about an hour from now", refreshed)
+	}
+
+	// the check scheduled for the old token finds it replaced
+	time.Sleep(time.Until(expiresAt) + 200*time.Millisecond)
+	if cause := client.Cause(); cause != nil {
+		t.Fatalf("session ended with %v after a refresh", cause)
+	}
+	if n := countSessions(); n != 1 {
+		t.Fatalf("%d sessions after the old token expired, want the refreshed one", n)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	conn, client := startTokenSession(t, "token-user")
+	expiresAt := client.TokenExpiresAt()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "another user", token: testToken(t, "someone-else", time.Hour)},
+		{name: "expired", token: testToken(t, "token-user", -time.Hour)},
+		{name: "not a token", token: "garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshToken(t, conn, tt.token)
+			msg := readUntil(t, conn, CONTROL_ERROR_RESPONSE)
+			if msg["code"] != string(CONTROL_ERR_INVALID_TOKEN) {
+				t.Errorf("got %v, want an invalid_token error", msg)
+			}
+			if at := client.TokenExpiresAt(); !at.Equal(expiresAt) {
+				t.Errorf("rejected token moved the deadline to %s", at)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package ws
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTranscriberClosed is returned by Receive once the upstream connection is gone.
+var ErrTranscriberClosed = errors.New("transcriber connection closed")
+
+type TRANSCRIPT_EVENT_TYPE string
+
+const (
+	TRANSCRIPT_BEGIN       TRANSCRIPT_EVENT_TYPE = "begin"
+	TRANSCRIPT_TURN        TRANSCRIPT_EVENT_TYPE = "turn"
+	TRANSCRIPT_TERMINATION TRANSCRIPT_EVENT_TYPE = "termination"
+	// the provider connection dropped, audio is buffered until a new one begins
+	TRANSCRIPT_RECONNECTING TRANSCRIPT_EVENT_TYPE = "reconnecting"
+	// a new provider connection began, it replaces the Begin of that connection
+	TRANSCRIPT_RECONNECTED TRANSCRIPT_EVENT_TYPE = "reconnected"
+)
+
+// TranscriptTurn is the provider-neutral shape of one speaker turn.
+// Words keep the AssemblyResponseWord layout because that is what the browser already reads.
+type TranscriptTurn struct {
+	TurnOrder  int
+	Transcript string
+	EndOfTurn  bool
+	// diarization label of the turn, empty when the provider doesn't label speakers
+	Speaker string
+	Words   []AssemblyResponseWord
+}
+
+type TranscriptEvent struct {
+	Type TRANSCRIPT_EVENT_TYPE
+	Turn *TranscriptTurn
+}
+
+// Transcriber is a streaming speech-to-text session.
+// SendAudio and Receive may be called from different goroutines.
+type Transcriber interface {
+	SendAudio(audio []byte) error
+	// Receive blocks until the provider emits the next event.
+	Receive() (*TranscriptEvent, error)
+	// Terminate asks the provider to flush the last words and end the session,
+	// a TRANSCRIPT_TERMINATION event follows.
+	Terminate() error
+	// ForceEndOfTurn makes the provider close the current turn right away.
+	ForceEndOfTurn() error
+	Close() error
+}
+
+// LanguageSwitcher is implemented by transcribers that can change the spoken language mid stream.
+type LanguageSwitcher interface {
+	SwitchLanguage(language string) error
+}
+
+// TranscriberFactory opens a transcription stream of the spoken language, ctx only bounds opening it.
+type TranscriberFactory func(ctx context.Context, language string) (Transcriber, error)
@@ -1,32 +1,43 @@
 package ws
 
 import (
-	"encoding/json"
 	"errors"
-	"log"
+	"strings"
+	"sync"
 )
 
 type TranscriptWriter struct {
+	Sequenced
 	Type        RESPONSE_TYPE          `json:"type"`
 	IsEndOfTurn bool                   `json:"isEndOfTurn"`
 	Words       []AssemblyResponseWord `json:"words"`
+	Speaker     string                 `json:"speaker,omitempty"`
+	SpeakerName string                 `json:"speakerName,omitempty"`
+	// partials of the same turn can be coalesced while queued
+	turnOrder int
 }
 
 type TranscriptState struct {
-	CurrentWordsTranscript chan (string)
-	CurrentSentence        []string
-	NewWords               []AssemblyResponseWord
-	CurrentTurnID          int
-	EndOfTurn              bool
+	CurrentSentence []string
+	NewWords        []AssemblyResponseWord
+	CurrentTurnID   int
+	EndOfTurn       bool
+
+	historyMu sync.Mutex
+	// every ended turn of the session, kept for persistence
+	history  []*TranscriptTurn
+	openTurn *TranscriptTurn
+	// diarization label -> name the user gave that speaker
+	speakerNames map[string]string
 }
 
 func NewTranscriptState() *TranscriptState {
 	return &TranscriptState{
-		CurrentWordsTranscript: make(chan string),
 		CurrentSentence: make([]string, 0, 10),
 		CurrentTurnID:   -1,
 		NewWords:        make([]AssemblyResponseWord, 0, 10),
 		EndOfTurn:       false,
+		speakerNames:    make(map[string]string),
 	}
 }
 
@@ -38,19 +49,15 @@ func NewTranscriptWriter(isFinal bool, words []AssemblyResponseWord) *Transcript
 	}
 }
 
-// Process the json data making the state short to send to client.
+// Process the turn from the transcriber making the state short to send to client.
 // These words are store in the client state Transcript.
 // The client will receive only the new words or the updated words.
-// Also translate service will use this state to translate only the new words.
-func (c *Client) updateStateTranscript(jsonData []byte) error {
-	var turn AssemblyRessponseTurn
-	err := json.Unmarshal(jsonData, &turn)
-	if err != nil {
-		err1 := errors.New("cant parse json from Assembly: ")
-		joinErr := errors.Join(err1, err)
-		return joinErr
+// Once a turn ends it is queued for the translate service.
+func (c *Client) updateStateTranscript(turn *TranscriptTurn) error {
+	if turn == nil {
+		return errors.New("empty turn from transcriber")
 	}
-	log.Println("[INFOR] process client msg")
+	c.Logger.Debug("processing turn", "turn_order", turn.TurnOrder, "end_of_turn", turn.EndOfTurn)
 
 	c.Transcript.NewWords = make([]AssemblyResponseWord, 0, 10)
 	for index, assemblyWord := range turn.Words {
@@ -73,20 +80,123 @@ func (c *Client) updateStateTranscript(jsonData []byte) error {
 
 	}
 
+	c.Transcript.recordTurn(turn)
+
 	c.Transcript.EndOfTurn = turn.EndOfTurn
 	if turn.EndOfTurn {
 		c.Transcript.CurrentSentence = make([]string, 0, 10)
 	}
 
 	clientTranscriptWriter := NewTranscriptWriter(c.Transcript.EndOfTurn, c.Transcript.NewWords)
-	c.TranscriptWord <- clientTranscriptWriter
-
-	str := ""
-	for _, w := range c.Transcript.NewWords {
-		str += w.Text + " "
+	clientTranscriptWriter.Speaker = turn.Speaker
+	clientTranscriptWriter.SpeakerName = c.Transcript.SpeakerName(turn.Speaker)
+	clientTranscriptWriter.turnOrder = turn.TurnOrder
+	c.transcriptOut.push(clientTranscriptWriter, c.ctx.Done())
+	if turn.EndOfTurn {
+		c.translateIn.push(turn, c.ctx.Done())
 	}
-	c.Transcript.CurrentWordsTranscript <- str
 
 	return nil
 
 }
+
+// endOpenTurn ends the turn a dropped upstream connection left open, the browser gets an
+// end of turn without new words and its final words are translated like any ended turn.
+func (c *Client) endOpenTurn() {
+	c.Transcript.CurrentSentence = make([]string, 0, 10)
+	turn := c.Transcript.closeOpenTurn()
+	if turn == nil {
+		return
+	}
+	msg := NewTranscriptWriter(true, []AssemblyResponseWord{})
+	msg.Speaker = turn.Speaker
+	msg.SpeakerName = c.Transcript.SpeakerName(turn.Speaker)
+	msg.turnOrder = turn.TurnOrder
+	c.transcriptOut.push(msg, c.ctx.Done())
+	c.translateIn.push(turn, c.ctx.Done())
+}
+
+func joinWords(words []AssemblyResponseWord) string {
+	texts := make([]string, 0, len(words))
+	for _, w := range words {
+		texts = append(texts, w.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
+func (t *TranscriptState) recordTurn(turn *TranscriptTurn) {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+	if turn.EndOfTurn {
+		t.history = append(t.history, turn)
+		t.openTurn = nil
+		return
+	}
+	t.openTurn = turn
+}
+
+// FinishedTurns returns every ended turn plus the final words of a turn
+// that was still open when the session stopped.
+func (t *TranscriptState) FinishedTurns() []*TranscriptTurn {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+
+	turns := make([]*TranscriptTurn, len(t.history), len(t.history)+1)
+	copy(turns, t.history)
+	if turn := finalPart(t.openTurn); turn != nil {
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+// closeOpenTurn ends the open turn with the words that were final, it returns nil without any.
+func (t *TranscriptState) closeOpenTurn() *TranscriptTurn {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+
+	turn := finalPart(t.openTurn)
+	t.openTurn = nil
+	if turn != nil {
+		t.history = append(t.history, turn)
+	}
+	return turn
+}
+
+// finalPart is the ended turn made of the final words of an open one.
+func finalPart(open *TranscriptTurn) *TranscriptTurn {
+	if open == nil {
+		return nil
+	}
+	finalWords := make([]AssemblyResponseWord, 0, len(open.Words))
+	for _, w := range open.Words {
+		if w.WordIsFinal {
+			finalWords = append(finalWords, w)
+		}
+	}
+	if len(finalWords) == 0 {
+		return nil
+	}
+	return &TranscriptTurn{
+		TurnOrder:  open.TurnOrder,
+		Transcript: joinWords(finalWords),
+		EndOfTurn:  true,
+		Speaker:    open.Speaker,
+		Words:      finalWords,
+	}
+}
+
+// SpeakerName is the name given to a diarization label, or the label itself.
+func (t *TranscriptState) SpeakerName(label string) string {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+	if name, ok := t.speakerNames[label]; ok {
+		return name
+	}
+	return label
+}
+
+func (t *TranscriptState) SetSpeakerName(label string, name string) {
+	t.historyMu.Lock()
+	t.speakerNames[label] = name
+	t.historyMu.Unlock()
+}
@@ -1,13 +1,99 @@
 package ws
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Spoken language of a session until the client sets another one.
+const DEFAULT_SOURCE_LANGUAGE = "en"
+
+// Languages AssemblyAI's multilingual streaming model understands.
+var SupportedTranscriptLanguages = []string{"en", "es", "fr", "de", "it", "pt"}
+
 type TranslateWriter struct {
-	Type  RESPONSE_TYPE `json:"type"`
-	Words string        `json:"words"`
+	Sequenced
+	Type      RESPONSE_TYPE `json:"type"`
+	TurnOrder int           `json:"turnOrder"`
+	Language  string        `json:"language"`
+	Words     string        `json:"words"`
 }
 
-func NewTranslateWriter(word string) *TranslateWriter {
+func NewTranslateWriter(turnOrder int, language string, words string) *TranslateWriter {
 	return &TranslateWriter{
-		Type:  TRANSLATE_RESPONSE,
-		Words: word,
+		Type:      TRANSLATE_RESPONSE,
+		TurnOrder: turnOrder,
+		Language:  language,
+		Words:     words,
+	}
+}
+
+type Translator interface {
+	Translate(ctx context.Context, text string, sourceLang string, targetLang string) (string, error)
+}
+
+// LanguageSupporter is implemented by translators that know their target languages.
+type LanguageSupporter interface {
+	SupportsLanguage(language string) bool
+}
+
+type TranslatorFactory func() Translator
+
+// HTTPTranslator calls a LibreTranslate compatible /translate endpoint.
+type HTTPTranslator struct {
+	ApiURL string
+	ApiKey string
+	client *http.Client
+}
+
+func NewHTTPTranslator(apiURL string, apiKey string) *HTTPTranslator {
+	return &HTTPTranslator{
+		ApiURL: strings.TrimRight(apiURL, "/"),
+		ApiKey: apiKey,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *HTTPTranslator) Translate(ctx context.Context, text string, sourceLang string, targetLang string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  sourceLang,
+		"target":  targetLang,
+		"format":  "text",
+		"api_key": h.ApiKey,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode translate request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.ApiURL+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("non-200 response: %d - %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse JSON response: %w", err)
 	}
+	return result.TranslatedText, nil
 }
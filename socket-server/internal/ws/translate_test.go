@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// GlossaryTranslator translates word by word from a dictionary.
+// Unknown words are kept as is, so the output is deterministic.
+type GlossaryTranslator struct {
+	// target language -> lower case source word -> translated word
+	Glossary map[string]map[string]string
+}
+
+func (g *GlossaryTranslator) SupportsLanguage(language string) bool {
+	_, ok := g.Glossary[language]
+	return ok
+}
+
+func (g *GlossaryTranslator) Translate(ctx context.Context, text string, sourceLang string, targetLang string) (string, error) {
+	dict, ok := g.Glossary[targetLang]
+	if !ok {
+		return "", fmt.Errorf("unsupported target language: %s", targetLang)
+	}
+
+	words := strings.Fields(text)
+	for i, word := range words {
+		core := strings.TrimRight(word, ".,!?;:")
+		punct := word[len(core):]
+		if translated, ok := dict[strings.ToLower(core)]; ok {
+			words[i] = translated + punct
+		}
+	}
+	return strings.Join(words, " "), nil
+}
+
+var testGlossary = map[string]map[string]string{
+	"es": {"hello": "hola", "world": "mundo", "this": "esto", "is": "es", "a": "una", "test": "prueba"},
+}
+
+func TestTranslation(t *testing.T) {
+	t.Run("finished turns are translated", func(t *testing.T) {
+		url, _ := startTestServer(t, func(s *Server) {
+			// the free plan doesn't translate
+			s.Config.Billing.Enforce = false
+			s.NewTranslator = func() Translator {
+				return &GlossaryTranslator{Glossary: testGlossary}
+			}
+		})
+		conn := dialSession(t, url+"&translate_to=es")
+		for range 10 {
+			if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		msg := readUntil(t, conn, TRANSLATE_RESPONSE)
+		if msg["words"] != "hola mundo" || msg["language"] != "es" {
+			t.Errorf("got translation %v, want hola mundo in es", msg)
+		}
+	})
+
+	t.Run("off without a translator", func(t *testing.T) {
+		url, _ := startTestServer(t, func(s *Server) {
+			s.Config.Billing.Enforce = false
+			s.NewTranslator = nil
+		})
+		conn := dialSession(t, url+"&translate_to=es")
+
+		plan := readUntil(t, conn, PLAN_RESPONSE)
+		if plan["translation"] != false {
+			t.Errorf("plan offers translation without a translator: %v", plan)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_translation","language":"es"}`)); err != nil {
+			t.Fatal(err)
+		}
+		msg := readUntil(t, conn, CONTROL_ERROR_RESPONSE)
+		if msg["code"] != string(CONTROL_ERR_INVALID_STATE) {
+			t.Errorf("got %v, want an invalid_state error", msg)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package ws
+
+type UPSTREAM_STATE string
+
+const (
+	// the provider accepted the connection, no Begin yet
+	UPSTREAM_CONNECTED UPSTREAM_STATE = "connected"
+	UPSTREAM_STREAMING UPSTREAM_STATE = "streaming"
+	// the connection dropped, audio is buffered until a new one begins
+	UPSTREAM_RECONNECTING UPSTREAM_STATE = "reconnecting"
+	// Terminate was sent, the provider is flushing the last turn
+	UPSTREAM_TERMINATING UPSTREAM_STATE = "terminating"
+	UPSTREAM_CLOSED      UPSTREAM_STATE = "closed"
+)
+
+func (c *Client) UpstreamState() UPSTREAM_STATE {
+	state, _ := c.upstreamState.Load().(UPSTREAM_STATE)
+	return state
+}
+
+func (c *Client) setUpstreamState(state UPSTREAM_STATE) {
+	c.upstreamState.Store(state)
+}
+
+// terminateUpstream asks the provider to flush the last turn, the session ends on its Termination.
+func (c *Client) terminateUpstream() error {
+	c.setUpstreamState(UPSTREAM_TERMINATING)
+	return c.Transcriber.Terminate()
+}
+
+// upstreamDropped closes the turn the dropped connection left open and tells the browser
+// its audio is kept until the transcription resumes.
+func (c *Client) upstreamDropped() {
+	c.Logger.Warn("upstream connection dropped, reconnecting")
+	if c.UpstreamState() != UPSTREAM_TERMINATING {
+		c.setUpstreamState(UPSTREAM_RECONNECTING)
+	}
+	c.endOpenTurn()
+	c.send(NewStatusWriter(DEGRADED_RESPONSE, "Transcription is reconnecting, your audio is kept"))
+}
+
+func (c *Client) upstreamRecovered() {
+	c.Logger.Info("upstream reconnected")
+	if c.UpstreamState() == UPSTREAM_RECONNECTING {
+		c.setUpstreamState(UPSTREAM_STREAMING)
+	}
+	c.send(NewStatusWriter(RECOVERED_RESPONSE, ""))
+}
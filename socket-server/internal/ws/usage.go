@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UsageRecorder writes the metered seconds of a finished session to the usage ledger,
+// with the audio file it was saved as or an empty audioId.
+type UsageRecorder func(ctx context.Context, userId string, sessionId string, audioId string, periodStart time.Time, audioSeconds int) error
+
+// usageMeter counts the audio every live session of one user sends upstream against
+// what was left of their quota when the first of them started, sessions running together share it.
+// The ledger only learns about a session once it ends, so the meter lives until the last one is recorded.
+type usageMeter struct {
+	limitBytes int64
+	usedBytes  atomic.Int64
+	// guarded by meters
+	sessions int
+}
+
+var meters = struct {
+	sync.Mutex
+	byUser map[string]*usageMeter
+}{byUser: make(map[string]*usageMeter)}
+
+func joinMeter(userId string, remainingSeconds int64) *usageMeter {
+	meters.Lock()
+	defer meters.Unlock()
+	m := meters.byUser[userId]
+	if m == nil {
+		m = &usageMeter{limitBytes: remainingSeconds * AUDIO_BYTES_PER_SECOND}
+		meters.byUser[userId] = m
+	}
+	m.sessions++
+	return m
+}
+
+func leaveMeter(userId string, m *usageMeter) {
+	meters.Lock()
+	defer meters.Unlock()
+	m.sessions--
+	if m.sessions == 0 && meters.byUser[userId] == m {
+		delete(meters.byUser, userId)
+	}
+}
+
+// add counts n bytes of provider audio, it returns false once the quota is used up.
+func (m *usageMeter) add(n int) bool {
+	return m.usedBytes.Add(int64(n)) <= m.limitBytes
+}
+
+func (m *usageMeter) remainingSeconds() int64 {
+	return max(m.limitBytes-m.usedBytes.Load(), 0) / AUDIO_BYTES_PER_SECOND
+}
+
+// meteredSeconds is the audio the session sent upstream, from the byte count of the 16kHz
+// mono pcm the provider gets so pauses, silence gaps and client formats don't change it.
+func (c *Client) meteredSeconds() int {
+	return int(math.Ceil(float64(c.audioBytes.Load()) / AUDIO_BYTES_PER_SECOND))
+}
+
+// meterAudio counts n bytes of audio against the user's quota. The first frame over it ends the
+// session like a stop: audio is no longer forwarded and the provider flushes the last turn.
+func (c *Client) meterAudio(n int) bool {
+	if c.meter == nil {
+		return true
+	}
+	if c.quotaExhausted.Load() {
+		return false
+	}
+	if c.meter.add(n) {
+		return true
+	}
+	if c.quotaExhausted.CompareAndSwap(false, true) {
+		c.Logger.Info("usage quota exhausted", "metered_seconds", c.meteredSeconds())
+		c.send(NewStatusWriter(ERROR_RESPONSE, "You have used all your transcription minutes for this month"))
+		if err := c.terminateUpstream(); err != nil {
+			c.Logger.Warn("failed to terminate upstream", "err", err)
+			c.Close(ErrQuotaExhausted)
+		}
+	}
+	return false
+}
+
+// recordUsage writes the session to the ledger and releases the user's meter. A session saved as
+// audioId is counted through its audio file, the ledger only counts it when it wasn't saved.
+func (c *Client) recordUsage(audioId string) {
+	if c.meter != nil {
+		defer leaveMeter(c.UserId, c.meter)
+	}
+	seconds := c.meteredSeconds()
+	if seconds == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Session.SaveTimeout)
+	defer cancel()
+	if err := c.recordUsageFn(ctx, c.UserId, c.SessionId, audioId, c.Entitlement.PeriodStart, seconds); err != nil {
+		c.Logger.Error("failed to record usage", "seconds", seconds, "err", err)
+		countError("recordUsage")
+		return
+	}
+	c.Logger.Info("recorded usage", "seconds", seconds, "period_start", c.Entitlement.PeriodStart, "audio_id", audioId)
+}
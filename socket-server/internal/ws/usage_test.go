@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"meetingmind-socket/internal/models"
+	"meetingmind-socket/internal/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type usageCall struct {
+	sessionId string
+	audioId   string
+	seconds   int
+}
+
+// withQuota puts the user on plan with one second of audio left this month and notes what is recorded.
+func withQuota(status service.SUBSCRIPTION_STATUS, recorded chan<- usageCall) func(s *Server) {
+	return func(s *Server) {
+		s.LookupEntitlement = func(ctx context.Context, userId string, now time.Time) (service.Entitlement, error) {
+			plan, _ := service.PlanForStatus(status)
+			return entitlementOf(status, plan.MonthlySeconds-1), nil
+		}
+		s.RecordUsage = func(ctx context.Context, userId string, sessionId string, audioId string, periodStart time.Time, audioSeconds int) error {
+			recorded <- usageCall{sessionId: sessionId, audioId: audioId, seconds: audioSeconds}
+			return nil
+		}
+	}
+}
+
+func sendFrames(t *testing.T, conn *websocket.Conn, frames int) {
+	t.Helper()
+	for range frames {
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readQuotaError(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	if msg := readUntil(t, conn, ERROR_RESPONSE); !strings.Contains(msg["message"].(string), "used all your transcription minutes") {
+		t.Fatalf("error message %v", msg)
+	}
+}
+
+// TestQuotaEndsTheSession streams past the last second of the quota: the browser is told, upstream
+// flushes the last turn and the session ends. The ledger gets the audio id of a saved session, a
+// session that couldn't be saved is counted in the ledger alone.
+func TestQuotaEndsTheSession(t *testing.T) {
+	savedId := uuid.New()
+	tests := []struct {
+		name        string
+		saveErr     error
+		wantAudioId string
+	}{
+		{name: "saved session", wantAudioId: savedId.String()},
+		{name: "session not saved", saveErr: errors.New("database down"), wantAudioId: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded := make(chan usageCall, 1)
+			url, fake := startTestServer(t, func(s *Server) {
+				withQuota("", recorded)(s)
+				s.SaveSession = func(ctx context.Context, ls service.LiveSession) (models.AudioFile, error) {
+					return models.AudioFile{ID: savedId}, tt.saveErr
+				}
+			})
+			conn := dialSession(t, url)
+			sessionId := readUntil(t, conn, SESSION_RESPONSE)["sessionId"].(string)
+			client := FindSession(sessionId)
+
+			// 10 frames are the second left, the fixture ends its first turn right there
+			sendFrames(t, conn, 12)
+			readQuotaError(t, conn)
+			waitFor(t, "session to end", func() bool { return countSessions() == 0 })
+			if cause := client.Cause(); !errors.Is(cause, ErrUpstreamEnded) {
+				t.Errorf("session ended with %v, want the upstream to be terminated", cause)
+			}
+			if n := fake.Sessions(); n != 1 {
+				t.Errorf("%d upstream sessions, want 1", n)
+			}
+
+			select {
+			case call := <-recorded:
+				if call.sessionId != sessionId || call.audioId != tt.wantAudioId || call.seconds != 1 {
+					t.Errorf("recorded %+v, want session %s, audio %q, 1 second", call, sessionId, tt.wantAudioId)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("usage was not recorded")
+			}
+		})
+	}
+}
+
+// TestQuotaIsSharedAcrossSessions runs two sessions of one Pro user on the same last second.
+func TestQuotaIsSharedAcrossSessions(t *testing.T) {
+	recorded := make(chan usageCall, 2)
+	url, _ := startTestServer(t, withQuota(service.SUBSCRIPTION_ACTIVE, recorded))
+
+	first := dialSession(t, url)
+	client := FindSession(readUntil(t, first, SESSION_RESPONSE)["sessionId"].(string))
+	second := dialSession(t, url)
+	readUntil(t, second, SESSION_RESPONSE)
+
+	sendFrames(t, first, 6)
+	waitFor(t, "audio of the first session to be metered", func() bool { return client.meter.usedBytes.Load() == 6*3200 })
+	// together past the 10 frames of the second left
+	sendFrames(t, second, 6)
+	readQuotaError(t, second)
+
+	// while the first session runs its meter knows better than the ledger, which still sees a second left
+	third, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if msg := readUntil(t, third, ERROR_RESPONSE); !strings.Contains(msg["message"].(string), "used all 50 hours") {
+		t.Errorf("third session: %v, want a quota refusal", msg)
+	}
+
+	sendFrames(t, first, 1)
+	readQuotaError(t, first)
+
+	seconds := 0
+	for range 2 {
+		select {
+		case call := <-recorded:
+			seconds += call.seconds
+		case <-time.After(5 * time.Second):
+			t.Fatal("usage of both sessions was not recorded")
+		}
+	}
+	if seconds != 2 {
+		t.Errorf("recorded %d seconds, want a second for each session", seconds)
+	}
+}
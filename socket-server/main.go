@@ -1,41 +1,131 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"log/slog"
 	"meetingmind-socket/internal/config"
 	"meetingmind-socket/internal/database"
 	"meetingmind-socket/internal/handler"
+	"meetingmind-socket/internal/logging"
+	"meetingmind-socket/internal/metrics"
+	"meetingmind-socket/internal/middleware"
 	"meetingmind-socket/internal/ws"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	config.CheckingAllEnvVars()
-	database.Init()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("invalid configuration:\n", err)
+	}
+	if err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		log.Fatal(err)
+	}
+
+	database.Init(cfg.DatabaseUrl)
 	postgres, err := database.DB.DB()
 	if err != nil {
 		panic(err)
 	}
 	defer postgres.Close()
 
+	wsServer, err := ws.NewServer(cfg)
+	if err != nil {
+		slog.Error("failed to set up the websocket server", "err", err)
+		os.Exit(1)
+	}
+
 	mux := http.NewServeMux()
+	limiter := middleware.NewRateLimiter(cfg.RateLimit)
+	// the ip limit goes before any token is verified, the user limit once the caller is known
+	route := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, middleware.Chain(h,
+			limiter.ByIP(pattern),
+			middleware.IdentifyUser(wsServer.Verifier),
+			limiter.ByUser(pattern),
+		))
+	}
 
-	mux.Handle("/", handler.HealthCheck())
-	mux.Handle("/ws", http.HandlerFunc(ws.RunServer))
+	route("/", handler.HealthCheck(cfg.FrontendUrl))
+	route("/healthz", handler.Healthz())
+	route("/readyz", handler.Readyz(cfg.Health.CheckTimeout, wsServer.IsDraining,
+		handler.Check{Name: "database", Run: database.Ping},
+		handler.Check{
+			Name:     "assemblyai",
+			Run:      func(ctx context.Context) error { return ws.CheckAssemblyAI(ctx, cfg.Upstream) },
+			CacheFor: cfg.Health.UpstreamCheckInterval,
+		},
+	))
+	route("/ws", http.HandlerFunc(wsServer.RunServer))
+	route("/ws/room", http.HandlerFunc(wsServer.RunViewer))
+	route("POST /rooms", middleware.Chain(http.HandlerFunc(wsServer.CreateRoom), middleware.AuthMiddleware(wsServer.Verifier)))
 
+	if len(cfg.Admin.UserIDs) > 0 {
+		admin := func(h http.HandlerFunc) http.Handler {
+			return middleware.Chain(h, middleware.AuthMiddleware(wsServer.Verifier), middleware.RequireUsers(cfg.Admin.UserIDs))
+		}
+		route("GET /admin/sessions", admin(wsServer.AdminListSessions))
+		route("GET /admin/sessions/{id}", admin(wsServer.AdminGetSession))
+		route("GET /admin/sessions/{id}/transcript", admin(wsServer.AdminSessionTranscript))
+		route("POST /admin/sessions/{id}/terminate", admin(wsServer.AdminTerminateSession))
+	}
 
-	port := os.Getenv("PORT")
-	fmt.Println("WebSocket server started on :", port)
-	Is_Prod := os.Getenv("IS_PROD")
-	var BIND_ADDR string
-	if Is_Prod == "" {
-		BIND_ADDR = "0.0.0.0:"
-	} else if Is_Prod == "true" {
-		BIND_ADDR = ":"
-	} else {
-		BIND_ADDR = "0.0.0.0:"
+	server := &http.Server{
+		Addr: cfg.Addr(),
+		// Metrics reads the pattern the mux sets on its request, the middlewares that replace
+		// the request must run before it
+		Handler: middleware.Chain(mux,
+			middleware.RealIP(cfg.RateLimit.TrustedProxies),
+			middleware.Logger,
+			middleware.Metrics,
+		),
+	}
+	go func() {
+		slog.Info("WebSocket server started", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("http server failed", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	// metrics stay off the public port, only the scraper reaches this listener
+	var metricsServer *http.Server
+	if cfg.Metrics.Addr != "" {
+		metrics.RegisterRuntime()
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: cfg.Metrics.Addr, Handler: metricsMux}
+		go func() {
+			slog.Info("metrics server started", "addr", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("metrics server failed", "err", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	<-ctx.Done()
+	stop()
+
+	slog.Info("shutting down, draining sessions", "timeout", cfg.Drain.Timeout)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Drain.Timeout)
+	defer cancel()
+	wsServer.Drain(drainCtx)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shut down http server", "err", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
 	}
-	log.Fatal(http.ListenAndServe(BIND_ADDR+port, mux))
+	slog.Info("server stopped")
 }
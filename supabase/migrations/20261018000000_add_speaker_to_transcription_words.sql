@@ -0,0 +1,3 @@
+-- Speaker of each word, the diarization label or the name given during the session
+ALTER TABLE transcription_words
+ADD COLUMN speaker text;
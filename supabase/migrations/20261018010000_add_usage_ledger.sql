@@ -0,0 +1,36 @@
+-- Audio seconds streamed by each live session. Quotas count audio_files durations of the month,
+-- plus the ledger of live sessions that weren't saved as an audio file (audio_id is null)
+create table if not exists public.usage_ledger (
+  id uuid not null default gen_random_uuid(),
+  user_id uuid not null,
+  session_id uuid not null,
+  audio_id uuid,
+  period_start timestamp with time zone not null,
+  audio_seconds integer not null,
+  created_at timestamp with time zone default now(),
+
+  constraint usage_ledger_pkey primary key (id),
+  constraint usage_ledger_session_id_key unique (session_id),
+
+  constraint usage_ledger_user_id_fkey
+    foreign key (user_id)
+    references auth.users (id)
+    on delete cascade,
+
+  -- a deleted recording still counts through the ledger
+  constraint usage_ledger_audio_id_fkey
+    foreign key (audio_id)
+    references public.audio_files (id)
+    on delete set null
+);
+
+create index if not exists idx_usage_ledger_user_period
+on public.usage_ledger (user_id, period_start);
+
+alter table public.usage_ledger enable row level security;
+
+-- Users can read their own usage, only the socket server writes it
+create policy "Users can read own usage"
+on public.usage_ledger
+for select
+using (auth.uid() = user_id);
@@ -0,0 +1,11 @@
+-- Live sessions saved without a recording have no file, an empty path tells the web app there's nothing to play
+drop index if exists public.idx_audio_files_user_path_unique;
+
+create unique index if not exists idx_audio_files_user_path_unique
+on public.audio_files (user_id, path)
+where path <> '';
+
+-- sessions saved before pointed at a file that never existed
+update public.audio_files
+set path = ''
+where path like 'live/%';